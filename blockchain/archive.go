@@ -0,0 +1,192 @@
+package blockchain
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/SunTzu71/suntzu_blockchain/constants"
+)
+
+// The chain archive format starts with a header made of ARCHIVE_MAGIC, a format version byte,
+// the chain ID and genesis block hash as length-prefixed strings and the number of blocks as an
+// 8 byte big-endian integer. Every block follows in order as a 4 byte big-endian length and the
+// block's JSON encoding, so archives can be written and read one block at a time.
+
+// ExportChain: writes the blocks of the chain to w in the chain archive format
+// Chains bootstrapped from a state snapshot cannot be exported, since they only hold the headers
+// of the blocks up to the snapshot height
+// Returns an error if writing fails
+func (bc *BlockchainCore) ExportChain(w io.Writer) error {
+	bc.mutex.Lock()
+	blocks := bc.Blocks
+	base := bc.BaseSnapshot
+	bc.mutex.Unlock()
+
+	if base != nil {
+		return fmt.Errorf("blockchain was bootstrapped from a snapshot, blocks up to height %d are not available", base.Height)
+	}
+
+	bw := bufio.NewWriter(w)
+
+	header := new(bytes.Buffer)
+	header.WriteString(constants.ARCHIVE_MAGIC)
+	header.WriteByte(constants.ARCHIVE_FORMAT_VERSION)
+	writeString(header, constants.CHAIN_ID)
+	writeString(header, blocks[0].Hash())
+	writeUint64(header, uint64(len(blocks)))
+
+	_, err := bw.Write(header.Bytes())
+	if err != nil {
+		return err
+	}
+
+	for _, block := range blocks {
+		data, err := json.Marshal(block)
+		if err != nil {
+			return err
+		}
+
+		record := new(bytes.Buffer)
+		writeBytes(record, data)
+		_, err = bw.Write(record.Bytes())
+		if err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
+
+// ImportChain: reads a chain archive from r and stores it as a new blockchain with the given address.
+// The archive must belong to our chain ID and genesis block, and every block is validated in order
+// as ValidateChain does before anything is written. The store must not hold a blockchain yet.
+// Returns the imported blockchain, or an error describing the first problem found.
+func ImportChain(r io.Reader, genesisBlock *Block, address string, store Store) (*BlockchainCore, error) {
+	if store.Exists() {
+		return nil, errors.New("database already holds a blockchain")
+	}
+
+	br := bufio.NewReader(r)
+
+	magic := make([]byte, len(constants.ARCHIVE_MAGIC))
+	_, err := io.ReadFull(br, magic)
+	if err != nil || string(magic) != constants.ARCHIVE_MAGIC {
+		return nil, errors.New("not a chain archive")
+	}
+
+	version, err := br.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if version != constants.ARCHIVE_FORMAT_VERSION {
+		return nil, fmt.Errorf("unsupported archive format version %d", version)
+	}
+
+	chainID, err := readString(br)
+	if err != nil {
+		return nil, err
+	}
+	if chainID != constants.CHAIN_ID {
+		return nil, fmt.Errorf("archive chain id %q does not match %q", chainID, constants.CHAIN_ID)
+	}
+
+	genesisHash, err := readString(br)
+	if err != nil {
+		return nil, err
+	}
+	if genesisHash != genesisBlock.Hash() {
+		return nil, fmt.Errorf("archive genesis %s does not match genesis %s", genesisHash, genesisBlock.Hash())
+	}
+
+	count, err := readUint64(br)
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, errors.New("archive holds no blocks")
+	}
+
+	validator := newChainValidator(genesisBlock, nil, []*Block{})
+	for i := uint64(0); i < count; i++ {
+		data, err := readBytes(br, constants.MAX_ARCHIVE_RECORD_SIZE)
+		if err != nil {
+			return nil, fmt.Errorf("reading block %d: %w", i, err)
+		}
+
+		block := new(Block)
+		err = json.Unmarshal(data, block)
+		if err != nil {
+			return nil, fmt.Errorf("decoding block %d: %w", i, err)
+		}
+
+		err = validator.connect(block)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	log.Println("Imported blocks:", count, "tip:", validator.chain[len(validator.chain)-1].Hash())
+
+	bc := new(BlockchainCore)
+	bc.TransactionPool = []*Transaction{}
+	bc.Blocks = validator.chain
+	bc.Address = address
+	bc.Peers = map[string]bool{}
+	bc.store = store
+	bc.index = NewChainIndex(nil, bc.Blocks)
+	bc.initPeerState()
+	bc.updateSnapshot()
+
+	err = store.SaveBlockchain(bc)
+	if err != nil {
+		return nil, err
+	}
+
+	return bc, nil
+}
+
+// readUint64: reads an integer written by writeUint64
+func readUint64(r io.Reader) (uint64, error) {
+	var b [8]byte
+	_, err := io.ReadFull(r, b[:])
+	if err != nil {
+		return 0, err
+	}
+
+	return binary.BigEndian.Uint64(b[:]), nil
+}
+
+// readBytes: reads a byte slice written by writeBytes, rejecting lengths above maxLength
+func readBytes(r io.Reader, maxLength uint32) ([]byte, error) {
+	var b [4]byte
+	_, err := io.ReadFull(r, b[:])
+	if err != nil {
+		return nil, err
+	}
+
+	length := binary.BigEndian.Uint32(b[:])
+	if length > maxLength {
+		return nil, fmt.Errorf("record length %d exceeds limit %d", length, maxLength)
+	}
+
+	v := make([]byte, length)
+	_, err = io.ReadFull(r, v)
+	if err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// readString: reads a string written by writeString
+func readString(r io.Reader) (string, error) {
+	v, err := readBytes(r, constants.MAX_ARCHIVE_RECORD_SIZE)
+
+	return string(v), err
+}
@@ -0,0 +1,114 @@
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/SunTzu71/suntzu_blockchain/constants"
+)
+
+// testArchive exports the blocks of bc to a chain archive
+func testArchive(t *testing.T, bc *BlockchainCore) []byte {
+	buf := new(bytes.Buffer)
+	if err := bc.ExportChain(buf); err != nil {
+		t.Fatalf("ExportChain() error = %v", err)
+	}
+
+	return buf.Bytes()
+}
+
+// testArchiveHeader returns an archive header with the given fields
+func testArchiveHeader(version byte, chainID string, genesisHash string, count uint64) *bytes.Buffer {
+	header := new(bytes.Buffer)
+	header.WriteString(constants.ARCHIVE_MAGIC)
+	header.WriteByte(version)
+	writeString(header, chainID)
+	writeString(header, genesisHash)
+	writeUint64(header, count)
+
+	return header
+}
+
+func TestExportImportChain(t *testing.T) {
+	bc := testBlockchain(3, "miner")
+	store := NewMemoryStore()
+
+	imported, err := ImportChain(bytes.NewReader(testArchive(t, bc)), bc.Blocks[0], "node", store)
+	if err != nil {
+		t.Fatalf("ImportChain() error = %v", err)
+	}
+
+	testSameBlocks(t, imported.Blocks, bc.Blocks)
+	if balance := imported.index.ImmatureBalance("miner"); balance != bc.index.ImmatureBalance("miner") {
+		t.Errorf("imported immature balance = %d, want %d", balance, bc.index.ImmatureBalance("miner"))
+	}
+
+	loaded, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	testSameBlocks(t, loaded.Blocks, bc.Blocks)
+}
+
+func TestImportChainRejects(t *testing.T) {
+	bc := testBlockchain(3, "miner")
+	genesis := bc.Blocks[0]
+	archive := testArchive(t, bc)
+
+	// Changing a block breaks the link from the block after it
+	changed := *bc.Blocks[2]
+	changed.Nonce++
+	tampered := &BlockchainCore{Blocks: []*Block{bc.Blocks[0], bc.Blocks[1], &changed, bc.Blocks[3]}}
+
+	tests := []struct {
+		name     string
+		archive  func() []byte
+		existing bool
+	}{
+		{"not an archive", func() []byte {
+			return []byte("not a chain archive at all")
+		}, false},
+		{"unsupported version", func() []byte {
+			return testArchiveHeader(constants.ARCHIVE_FORMAT_VERSION+1, constants.CHAIN_ID, genesis.Hash(), 1).Bytes()
+		}, false},
+		{"other chain", func() []byte {
+			return testArchiveHeader(constants.ARCHIVE_FORMAT_VERSION, "suntzuchain-testnet", genesis.Hash(), 1).Bytes()
+		}, false},
+		{"other genesis", func() []byte {
+			return testArchiveHeader(constants.ARCHIVE_FORMAT_VERSION, constants.CHAIN_ID, "0x0", 1).Bytes()
+		}, false},
+		{"no blocks", func() []byte {
+			return testArchiveHeader(constants.ARCHIVE_FORMAT_VERSION, constants.CHAIN_ID, genesis.Hash(), 0).Bytes()
+		}, false},
+		{"record above the size limit", func() []byte {
+			header := testArchiveHeader(constants.ARCHIVE_FORMAT_VERSION, constants.CHAIN_ID, genesis.Hash(), 1)
+			header.Write([]byte{0xff, 0xff, 0xff, 0xff})
+			return header.Bytes()
+		}, false},
+		{"truncated", func() []byte {
+			return archive[:len(archive)-10]
+		}, false},
+		{"invalid block", func() []byte {
+			return testArchive(t, tampered)
+		}, false},
+		{"store holds a blockchain", func() []byte {
+			return archive
+		}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemoryStore()
+			if tt.existing {
+				store.SaveBlockchain(bc)
+			}
+
+			if _, err := ImportChain(bytes.NewReader(tt.archive()), genesis, "node", store); err == nil {
+				t.Fatal("ImportChain() error = nil, want an error")
+			}
+			if !tt.existing && store.Exists() {
+				t.Error("rejected archive was written to the store")
+			}
+		})
+	}
+}
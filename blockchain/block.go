@@ -10,22 +10,44 @@ import (
 )
 
 type Block struct {
-	BlockNumber  uint64         `json:"block_number"`
-	PrevHash     string         `json:"prev_hash"`
-	Timestamp    int64          `json:"timestamp"`
-	Nonce        int64          `json:"nonce"`
-	Transactions []*Transaction `json:"transactions"`
+	ChainID          string         `json:"chain_id"`
+	BlockNumber      uint64         `json:"block_number"`
+	PrevHash         string         `json:"prev_hash"`
+	Timestamp        int64          `json:"timestamp"`
+	Nonce            int64          `json:"nonce"`
+	Difficulty       int            `json:"difficulty"`
+	CoinbaseMaturity uint64         `json:"coinbase_maturity"`
+	MerkleRoot       string         `json:"merkle_root"`
+	Transactions     []*Transaction `json:"transactions"`
 }
 
-// NewBlock creates a new Block instance with the provided previous hash and nonce value,
-// initializing its timestamp to the current time and an empty transaction list
-func NewBlock(prevHash string, nonce int64, blockNumber uint64) *Block {
+// BlockHeader holds the fields of a block that are covered by its hash and proof-of-work.
+// Transactions are committed to through the Merkle root.
+type BlockHeader struct {
+	ChainID          string `json:"chain_id"`
+	BlockNumber      uint64 `json:"block_number"`
+	PrevHash         string `json:"prev_hash"`
+	Timestamp        int64  `json:"timestamp"`
+	Nonce            int64  `json:"nonce"`
+	Difficulty       int    `json:"difficulty"`
+	CoinbaseMaturity uint64 `json:"coinbase_maturity"`
+	MerkleRoot       string `json:"merkle_root"`
+}
+
+// NewBlock creates a new Block instance for the configured chain ID and coinbase maturity with the provided
+// previous hash, nonce value and mining difficulty, initializing its timestamp to the current time and an empty transaction list.
+// The Merkle root must be recalculated with CalculateMerkleRoot once transactions are added.
+func NewBlock(prevHash string, nonce int64, blockNumber uint64, difficulty int) *Block {
 	block := new(Block)
+	block.ChainID = constants.CHAIN_ID
 	block.PrevHash = prevHash
 	block.Timestamp = time.Now().Unix()
 	block.Nonce = nonce
+	block.Difficulty = difficulty
+	block.CoinbaseMaturity = constants.COINBASE_MATURITY
 	block.Transactions = []*Transaction{}
 	block.BlockNumber = blockNumber
+	block.MerkleRoot = block.CalculateMerkleRoot()
 
 	return block
 }
@@ -41,11 +63,30 @@ func (b Block) ToJson() string {
 	return string(nb)
 }
 
-// Hash calculates and returns a SHA-256 hash of the block's contents as a hexadecimal string,
-// prefixed with the hex prefix constant
+// Header returns the header fields of the block
+func (b Block) Header() BlockHeader {
+	return BlockHeader{
+		ChainID:          b.ChainID,
+		BlockNumber:      b.BlockNumber,
+		PrevHash:         b.PrevHash,
+		Timestamp:        b.Timestamp,
+		Nonce:            b.Nonce,
+		Difficulty:       b.Difficulty,
+		CoinbaseMaturity: b.CoinbaseMaturity,
+		MerkleRoot:       b.MerkleRoot,
+	}
+}
+
+// Hash calculates and returns a SHA-256 hash of the block's header as a hexadecimal string,
+// prefixed with the hex prefix constant. Transactions are covered through the Merkle root.
 func (b Block) Hash() string {
-	bs, _ := json.Marshal(b)
-	sum := sha256.Sum256(bs)
+	return b.Header().Hash()
+}
+
+// Hash calculates and returns a SHA-256 hash of the header's canonical encoding as a
+// hexadecimal string, prefixed with the hex prefix constant
+func (h BlockHeader) Hash() string {
+	sum := sha256.Sum256(h.Encode())
 	hexRep := hex.EncodeToString(sum[:32])
 	formattedHexRep := constants.HEX_PREFIX + hexRep
 
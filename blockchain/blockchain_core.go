@@ -2,9 +2,10 @@ package blockchain
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
-	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/SunTzu71/suntzu_blockchain/constants"
 )
@@ -14,22 +15,44 @@ type BlockchainCore struct {
 	Blocks          []*Block        `json:"blocks"`
 	Address         string          `json:"address"`
 	Peers           map[string]bool `json:"peers"`
-	MiningLocked    bool            `json:"mining_locked"`
+	MiningLocked    atomic.Bool     `json:"-"`
+	BaseSnapshot    *StateSnapshot  `json:"base_snapshot,omitempty"`
+	mutex           sync.Mutex
+	blockRejections []BlockRejection
+	reorgEvents     []ReorgEvent
+	store           Store
+	index           *ChainIndex
+	latestSnapshot  *StateSnapshot
+	syncManager     *SyncManager
+	seenBlocks      *seenCache
+	orphans         *orphanPool
+	gossip          *transactionGossip
+	peerBook        *peerBook
+	peerScores      *peerScores
+	clientScores    *peerScores
+	poolUpdates     atomic.Uint64
 }
 
-var mutex sync.Mutex
-
-// NewBlockchain: creates a new blockchain instance with a genesis block
-// If blockchain data exists in the database (checked via DBKeyExists), retrieves and returns it
-// Otherwise creates a new blockchain with the genesis block and persists it via DBAddBlockchain
+// NewBlockchain: creates a new blockchain instance with a genesis block, persisted in the given store
+// If the store already holds a blockchain (checked via Exists), retrieves and returns it,
+// exiting if it was created from a different genesis block
+// Otherwise creates a new blockchain with the genesis block and persists it via SaveBlockchain
 // Returns a pointer to the BlockchainCore instance in either case
-func NewBlockchain(genesisBlock Block, address string) *BlockchainCore {
-	if DBKeyExists() {
-		blockchianCore, err := DBGetBlockchain()
+func NewBlockchain(genesisBlock Block, address string, store Store) *BlockchainCore {
+	if store.Exists() {
+		blockchianCore, err := store.Load()
 		if err != nil {
 			log.Fatal(err)
 		}
 
+		if blockchianCore.Blocks[0].Hash() != genesisBlock.Hash() {
+			log.Fatalf("Database genesis %s does not match genesis %s", blockchianCore.Blocks[0].Hash(), genesisBlock.Hash())
+		}
+
+		blockchianCore.store = store
+		blockchianCore.index = NewChainIndex(blockchianCore.BaseSnapshot, blockchianCore.Blocks)
+		blockchianCore.initPeerState()
+		blockchianCore.updateSnapshot()
 		return blockchianCore
 	} else {
 		blockchainCore := new(BlockchainCore)
@@ -38,9 +61,11 @@ func NewBlockchain(genesisBlock Block, address string) *BlockchainCore {
 		blockchainCore.Blocks = append(blockchainCore.Blocks, &genesisBlock)
 		blockchainCore.Address = address
 		blockchainCore.Peers = map[string]bool{}
-		blockchainCore.MiningLocked = false
+		blockchainCore.store = store
+		blockchainCore.index = NewChainIndex(nil, blockchainCore.Blocks)
+		blockchainCore.initPeerState()
 
-		err := DBAddBlockchain(*blockchainCore)
+		err := store.SaveBlockchain(blockchainCore)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -50,30 +75,57 @@ func NewBlockchain(genesisBlock Block, address string) *BlockchainCore {
 }
 
 // NewBlockchainSync: creates a copy of an existing blockchain with a new address
-// Takes a pointer to an existing BlockchainCore and a new address string
+// Takes a pointer to an existing BlockchainCore, a new address string and the store to persist it in
 // Returns a pointer to the new BlockchainCore instance with updated address
-func NewBlockchainSync(bc1 *BlockchainCore, address string) *BlockchainCore {
+func NewBlockchainSync(bc1 *BlockchainCore, address string, store Store) *BlockchainCore {
 	bc2 := bc1
 	bc2.Address = address
+	bc2.store = store
+	bc2.index = NewChainIndex(bc2.BaseSnapshot, bc2.Blocks)
+	bc2.initPeerState()
+	bc2.updateSnapshot()
 
-	err := DBAddBlockchain(*bc2)
+	err := store.SaveBlockchain(bc2)
 	if err != nil {
 		log.Fatal(err)
 	}
 	return bc2
 }
 
+// initPeerState: creates the sync manager, the block and transaction relay state, the peer book and the
+// peer and client scores used to talk to peers and clients. The peer bans are loaded from the store.
+func (bc *BlockchainCore) initPeerState() {
+	bc.syncManager = NewSyncManager(bc)
+	bc.seenBlocks = newSeenCache(constants.SEEN_BLOCK_CACHE_SIZE)
+	bc.orphans = newOrphanPool()
+	bc.gossip = newTransactionGossip(bc)
+	bc.peerBook = newPeerBook()
+
+	scores, err := newPeerScores(bc.store)
+	if err != nil {
+		log.Fatal(err)
+	}
+	bc.peerScores = scores
+
+	// Clients are scored by IP address, so their bans are kept apart from the peer bans and never saved
+	clientScores, err := newPeerScores(NewMemoryStore())
+	if err != nil {
+		log.Fatal(err)
+	}
+	bc.clientScores = clientScores
+}
+
 // PeersToJson converts the BlockchainCore structure to JSON bytes
 // Returns the byte array representation of the BlockchainCore
-func (bc BlockchainCore) PeersToJson() []byte {
-	nb, _ := json.Marshal(bc.Peers)
+func (bc *BlockchainCore) PeersToJson() []byte {
+	nb, _ := json.Marshal(bc.GetPeers())
 
 	return nb
 }
 
 // ToJson converts the BlockchainCore structure to a JSON string
 // Returns the JSON string representation or an error message if marshal fails
-func (bc BlockchainCore) ToJson() string {
+func (bc *BlockchainCore) ToJson() string {
 	nb, err := json.Marshal(bc)
 	if err != nil {
 		return err.Error()
@@ -82,65 +134,87 @@ func (bc BlockchainCore) ToJson() string {
 	return string(nb)
 }
 
-// appendTransaction safely appends a transaction to the blockchain's transaction pool
-// using mutex locking to prevent concurrent access. Takes a transaction pointer and
-// adds it to the TransactionPool slice.
-func (bc *BlockchainCore) appendTransaction(transaction *Transaction) {
-	mutex.Lock()
-	defer mutex.Unlock()
+// GetBlocks: returns the blocks of our chain from genesis to the tip. The returned slice is never modified,
+// connected blocks are appended past its end and reorganizations replace the slice, so it can be read
+// after the mutex is released.
+func (bc *BlockchainCore) GetBlocks() []*Block {
+	bc.mutex.Lock()
+	defer bc.mutex.Unlock()
+
+	return bc.Blocks
+}
 
+// appendTransaction appends a transaction to the blockchain's transaction pool and saves it.
+// Must be called with the mutex held.
+func (bc *BlockchainCore) appendTransaction(transaction *Transaction) {
 	bc.TransactionPool = append(bc.TransactionPool, transaction)
+	bc.poolUpdates.Add(1)
 
-	// Save the blockchain to the database
-	err := DBAddBlockchain(*bc)
+	// Save the new transaction to the database
+	err := bc.store.AddPoolTransaction(transaction)
 	if err != nil {
 		log.Fatal(err)
 	}
 }
 
 // AddTransactionToTransactionPool: processes a new transaction and adds it to the transaction pool.
-// It verifies the transaction's signature and checks if the sender has sufficient balance
-// by simulating the impact of pending transactions. The transaction's status is updated
-// based on verification results and it is added to the pool. The blockchain state is then
-// persisted to the database.
-func (bc *BlockchainCore) AddTransactionToTransactionPool(transaction *Transaction) {
+// Transactions already in the pool or the chain are ignored. It verifies the transaction's signature,
+// checks that its nonce is the sender's next expected nonce and checks if the sender has sufficient balance
+// by simulating the impact of pending transactions. Transactions failing any of these checks are dropped,
+// verified ones are added to the pool, persisted to the database and announced to our peers.
+// Returns false if the transaction's signature is invalid
+func (bc *BlockchainCore) AddTransactionToTransactionPool(transaction *Transaction) bool {
+	return bc.addTransaction(transaction, "")
+}
 
-	for _, txn := range bc.TransactionPool {
-		if txn.TransactionHash == transaction.TransactionHash {
-			return
-		}
+// addTransaction: adds a transaction to the transaction pool as AddTransactionToTransactionPool does,
+// announcing it to every peer except origin, the peer it was received from. Failed transactions are
+// neither pooled nor announced, so peers never fetch from us a transaction they would reject.
+// Returns false if the transaction's signature is invalid
+func (bc *BlockchainCore) addTransaction(transaction *Transaction, origin string) bool {
+	// The signature does not depend on the chain, so it is verified before taking the lock
+	validTransaction := transaction.VerifyTransaction()
+
+	if bc.admitTransaction(transaction, validTransaction) {
+		bc.gossip.announce(transaction.TransactionHash, origin)
 	}
 
-	log.Println("Adding transaction to transaction pool")
+	return validTransaction
+}
 
-	// Send transaction in original format to all peers
-	newTransaction := new(Transaction)
-	newTransaction.Data = transaction.Data
-	newTransaction.From = transaction.From
-	newTransaction.To = transaction.To
-	newTransaction.Status = transaction.Status
-	newTransaction.Timestamp = transaction.Timestamp
-	newTransaction.Value = transaction.Value
-	newTransaction.TransactionHash = transaction.TransactionHash
-	newTransaction.PublicKey = transaction.PublicKey
-	newTransaction.Signature = transaction.Signature
+// admitTransaction: checks the nonce and balance of a transaction against the chain and the pool and appends it
+// to the pool if it passes, dropping it otherwise. The checks and the append happen under the mutex, so two transactions
+// with the same nonce cannot both be admitted. Transactions already in the pool or the chain are ignored.
+// Returns true if the transaction was added to the pool
+func (bc *BlockchainCore) admitTransaction(transaction *Transaction, validTransaction bool) bool {
+	bc.mutex.Lock()
+	defer bc.mutex.Unlock()
 
-	validTransaction := transaction.VerifyTransaction()
+	if bc.hasPoolTransaction(transaction.TransactionHash) {
+		return false
+	}
+
+	// Transactions that already left the pool in a block must not be replayed
+	if bc.isTransactionInChain(transaction.TransactionHash) {
+		return false
+	}
+
+	log.Println("Adding transaction to transaction pool")
 
 	validRealBalance := bc.simulatedBalanceCheck(validTransaction, transaction)
 
-	if validTransaction && validRealBalance {
-		transaction.Status = constants.TRANSACTION_VERIFY_SUCCESS
-	} else {
+	validNonce := transaction.Nonce == bc.GetNextNonce(transaction.From)
+
+	if !validTransaction || !validRealBalance || !validNonce {
+		log.Println("Dropping transaction", transaction.TransactionHash, "that failed verification")
 		transaction.Status = constants.TRANSACTION_VERIFY_FAILED
+		return false
 	}
 
-	transaction.PublicKey = ""
-
+	transaction.Status = constants.TRANSACTION_VERIFY_SUCCESS
 	bc.appendTransaction(transaction)
 
-	// TODO: this may need to be moved after transaction status is successfully updated
-	bc.BroadcastTransaction(newTransaction)
+	return true
 }
 
 // simulatedBalanceCheck: validates if an account has sufficient funds for a pending transaction
@@ -151,142 +225,131 @@ func (bc *BlockchainCore) AddTransactionToTransactionPool(transaction *Transacti
 func (bc *BlockchainCore) simulatedBalanceCheck(validTrans bool, transaction *Transaction) bool {
 	balance := bc.CalculateTotalCrypto(transaction.From)
 	for _, txx := range bc.TransactionPool {
-		if transaction.From == txx.From && validTrans {
-			if balance >= txx.Value {
-				balance -= txx.Value
+		if transaction.From == txx.From && txx.Status == constants.TRANSACTION_VERIFY_SUCCESS && validTrans {
+			if balance >= txx.Cost() {
+				balance -= txx.Cost()
 			} else {
 				break
 			}
 		}
 	}
-	return balance >= transaction.Value
+	return balance >= transaction.Cost()
 }
 
-// AddBlock adds a new block to the blockchain and removes its transactions from the transaction pool.
+// AddBlock adds a new block to the blockchain and revalidates the transaction pool on top of it.
 // It takes a pointer to a Block as input and updates both the blockchain's transaction pool
-// and blocks array. Transactions in the new block are removed from the pool to prevent double-spending.
+// and blocks array. Transactions in the new block are removed from the pool to prevent double-spending,
+// and pending transactions the block made invalid, such as spends of the same balance, are dropped.
+// Blocks that no longer extend our tip, because the chain changed while they were mined or validated,
+// are discarded. The connected block is announced to our peers.
 func (bc *BlockchainCore) AddBlock(b *Block) {
-	mutex.Lock()
-	defer mutex.Unlock()
+	bc.mutex.Lock()
+	if b.PrevHash != bc.Blocks[len(bc.Blocks)-1].Hash() {
+		bc.mutex.Unlock()
+		log.Println("Discarding block", b.BlockNumber, "that does not extend our tip")
+		return
+	}
+	bc.appendBlock(b)
+	bc.mutex.Unlock()
+
+	bc.updateSnapshot()
+	go bc.AnnounceBlock(b)
+}
 
-	// Create a map of transaction hashes in the new block
-	txnMap := make(map[string]bool)
-	for _, txn := range b.Transactions {
-		txnMap[txn.TransactionHash] = true
+// connectTip: validates a block extending our tip and connects it as AddBlock does. The tip check, the validation
+// and the append happen under the mutex, so no other block can be connected in between.
+// Returns false if the block no longer extends our tip, and a *ValidationError if the block is invalid.
+func (bc *BlockchainCore) connectTip(b *Block) (bool, error) {
+	bc.mutex.Lock()
+	if b.PrevHash != bc.Blocks[len(bc.Blocks)-1].Hash() {
+		bc.mutex.Unlock()
+		return false, nil
 	}
 
-	// Create a new slice for transactions that should remain in the pool
-	var newTransactionPool []*Transaction
-	for _, txn := range bc.TransactionPool {
-		if !txnMap[txn.TransactionHash] {
-			newTransactionPool = append(newTransactionPool, txn)
-		}
+	err := newTipValidator(bc.Blocks, bc.index).connect(b)
+	if err != nil {
+		bc.mutex.Unlock()
+		return false, err
 	}
 
-	// Replace the transaction pool with the filtered version
-	bc.TransactionPool = newTransactionPool
+	bc.appendBlock(b)
+	bc.mutex.Unlock()
+
+	bc.updateSnapshot()
+	go bc.AnnounceBlock(b)
+
+	return true, nil
+}
 
+// appendBlock: connects a block extending our tip to the chain and the chain index, revalidates the
+// transaction pool on top of it and saves both. Must be called with the mutex held.
+func (bc *BlockchainCore) appendBlock(b *Block) {
 	// Add block to blockchain
 	bc.Blocks = append(bc.Blocks, b)
+	bc.index.connectBlock(b)
+	bc.revalidateTransactionPool(nil)
 
-	// Save the blockchain to the database
-	err := DBAddBlockchain(*bc)
+	// Save the new block and the filtered pool to the database
+	err := bc.store.ConnectBlock(b, bc.TransactionPool)
 	if err != nil {
 		log.Fatal(err)
 	}
+
+	bc.seenBlocks.add(b.Hash())
 }
 
 // ProofOfWorkMining continuously mines new blocks using proof of work consensus.
-// It takes a miner's address as input and rewards successful mining with coins.
-// The function runs indefinitely, creating new blocks that meet the mining difficulty
-// requirement by incrementing a nonce value until a valid hash is found.
+// It takes a miner's address as input and rewards successful mining with coins and transaction fees.
+// The function runs indefinitely, creating new blocks that meet the difficulty dictated by
+// NextDifficulty by incrementing a nonce value until a valid hash is found. The block template is only
+// rebuilt when the tip or the transaction pool changed, so every other guess only hashes the header.
+// Mined blocks are validated and connected with connectTip, which announces them.
 func (bc *BlockchainCore) ProofOfWorkMining(minersAddress string) {
 	log.Println("Proof of work mining started")
 
-	var nonce int64 = 0
+	var guessBlock *Block
+	var templateUpdates uint64
 
 	for {
-		if bc.MiningLocked {
-			continue
-		}
-
-		prevHash := bc.Blocks[len(bc.Blocks)-1].Hash()
-
-		guessBlock := NewBlock(prevHash, nonce, uint64(len(bc.Blocks)))
-
-		if bc.MiningLocked {
+		if bc.MiningLocked.Load() {
 			continue
 		}
 
-		for _, txn := range bc.TransactionPool {
-
-			if bc.MiningLocked {
-				continue
-			}
-
-			newTxn := new(Transaction)
-			newTxn.Data = txn.Data
-			newTxn.From = txn.From
-			newTxn.To = txn.To
-			newTxn.Status = txn.Status
-			newTxn.Timestamp = txn.Timestamp
-			newTxn.Value = txn.Value
-			newTxn.TransactionHash = txn.TransactionHash
-			newTxn.PublicKey = txn.PublicKey
-			newTxn.Signature = txn.Signature
-
-			guessBlock.AddTransactionToTheBlock(newTxn)
-		}
-
-		if bc.MiningLocked {
-			continue
+		// The pool is revalidated whenever the tip changes, so its update count covers both
+		updates := bc.poolUpdates.Load()
+		if guessBlock == nil || updates != templateUpdates {
+			guessBlock = bc.NewBlockTemplate(minersAddress, 0)
+			templateUpdates = updates
+		} else {
+			guessBlock.Nonce++
 		}
 
-		rewardTxn := NewTransaction(constants.BLOCKCHAIN_ADDRESS, minersAddress, constants.MINING_REWARD, []byte{})
-		rewardTxn.Status = constants.SUCCESS
-		guessBlock.Transactions = append(guessBlock.Transactions, rewardTxn)
-
 		// guess the hash
-		guessHash := guessBlock.Hash()
-		desiredHash := strings.Repeat("0", constants.MINING_DIFFICULTY)
-		ourSolutionHash := guessHash[2 : 2+constants.MINING_DIFFICULTY]
-
-		if bc.MiningLocked {
-			continue
-		}
-
-		if ourSolutionHash == desiredHash {
-
-			if !bc.MiningLocked {
-				bc.AddBlock(guessBlock)
-				log.Println("Mined block number: ", guessBlock.BlockNumber)
+		if meetsDifficulty(guessBlock.Hash(), guessBlock.Difficulty) {
+
+			// The template may be out of date by now, so it is validated like a peer's block
+			if !bc.MiningLocked.Load() {
+				connected, err := bc.connectTip(guessBlock)
+				if err != nil {
+					log.Println("Discarding invalid mined block:", err.Error())
+				} else if !connected {
+					log.Println("Discarding mined block", guessBlock.BlockNumber, "that does not extend our tip")
+				} else {
+					log.Println("Mined block number: ", guessBlock.BlockNumber)
+				}
 			}
 
-			nonce = 0
-			continue
+			guessBlock = nil
 		}
-		nonce++
 	}
 }
 
-// CalculateTotalCrypto: calculates the total balance of cryptocurrency for a given address
-// by examining all successful transactions in both the blockchain and transaction pool.
-// It adds received amounts (To) and subtracts sent amounts (From) for the address.
+// CalculateTotalCrypto: calculates the spendable balance of cryptocurrency for a given address
+// from the balance maintained by the chain index and the successful transactions in the transaction pool.
+// It adds received amounts (To) and subtracts sent amounts plus fees (From) for the address.
+// Mining rewards are only counted once they are spendable by the next block.
 func (bc *BlockchainCore) CalculateTotalCrypto(address string) uint64 {
-	var balance uint64 = 0
-
-	for _, block := range bc.Blocks {
-		for _, txn := range block.Transactions {
-			if txn.Status == constants.SUCCESS {
-				if txn.To == address {
-					balance += txn.Value
-				}
-				if txn.From == address {
-					balance -= txn.Value
-				}
-			}
-		}
-	}
+	balance := bc.index.Balance(address)
 
 	for _, txn := range bc.TransactionPool {
 		if txn.Status == constants.SUCCESS {
@@ -294,7 +357,7 @@ func (bc *BlockchainCore) CalculateTotalCrypto(address string) uint64 {
 				balance += txn.Value
 			}
 			if txn.From == address {
-				balance -= txn.Value
+				balance -= txn.Cost()
 			}
 		}
 	}
@@ -302,10 +365,16 @@ func (bc *BlockchainCore) CalculateTotalCrypto(address string) uint64 {
 	return balance
 }
 
+// CalculateImmatureCrypto: calculates the total of the mining rewards paid to an address
+// that have not reached COINBASE_MATURITY confirmations yet
+func (bc *BlockchainCore) CalculateImmatureCrypto(address string) uint64 {
+	return bc.index.ImmatureBalance(address)
+}
+
 // GetAllTransactions: retrieves all transactions from both the transaction pool and blocks
 // in reverse chronological order (newest first). It first collects transactions from the
-// transaction pool, then adds transactions from blocks, excluding mining reward transactions
-// (those from BLOCKCHAIN_ADDRESS). Returns a slice of all non-reward transactions.
+// transaction pool, then adds the transactions of the blocks that are not mining rewards
+// (those from BLOCKCHAIN_ADDRESS) as kept by the chain index. Returns a slice of all non-reward transactions.
 func (bc *BlockchainCore) GetAllNonRewardedTransactions() []Transaction {
 
 	newestTxns := []Transaction{}
@@ -314,19 +383,68 @@ func (bc *BlockchainCore) GetAllNonRewardedTransactions() []Transaction {
 		newestTxns = append(newestTxns, *bc.TransactionPool[i])
 	}
 
-	txns := []Transaction{}
+	for _, entry := range bc.index.NonRewarded() {
+		newestTxns = append(newestTxns, *entry.Transaction)
+	}
 
-	for _, block := range bc.Blocks {
-		for _, txn := range block.Transactions {
-			if txn.From != constants.BLOCKCHAIN_ADDRESS {
-				txns = append(txns, *txn)
-			}
+	return newestTxns
+}
+
+// isTransactionInPool: reports whether a transaction with the given hash is in the transaction pool
+func (bc *BlockchainCore) isTransactionInPool(txnHash string) bool {
+	bc.mutex.Lock()
+	defer bc.mutex.Unlock()
+
+	return bc.hasPoolTransaction(txnHash)
+}
+
+// hasPoolTransaction: reports whether a transaction with the given hash is in the transaction pool.
+// Must be called with the mutex held.
+func (bc *BlockchainCore) hasPoolTransaction(txnHash string) bool {
+	for _, txn := range bc.TransactionPool {
+		if txn.TransactionHash == txnHash {
+			return true
 		}
 	}
 
-	for i := len(txns) - 1; i >= 0; i-- {
-		newestTxns = append(newestTxns, txns[i])
+	return false
+}
+
+// isTransactionInChain: reports whether a transaction with the given hash is included in any block
+func (bc *BlockchainCore) isTransactionInChain(txnHash string) bool {
+	_, ok := bc.index.Transaction(txnHash)
+
+	return ok
+}
+
+// GetTransaction: looks up a transaction included in the chain by its hash
+// Returns an error if the transaction is not in any block
+func (bc *BlockchainCore) GetTransaction(txnHash string) (*IndexedTransaction, error) {
+	entry, ok := bc.index.Transaction(txnHash)
+	if !ok {
+		return nil, errors.New("transaction not found in any block")
 	}
 
-	return newestTxns
+	return entry, nil
+}
+
+// GetAddressHistory: returns a page of the transactions included in the chain that were sent
+// or received by an address, newest first, along with the address's total number of transactions
+func (bc *BlockchainCore) GetAddressHistory(address string, offset int, limit int) ([]*IndexedTransaction, int) {
+	return bc.index.AddressHistory(address, offset, limit)
+}
+
+// GetNextNonce: returns the nonce the next transaction from an address must carry.
+// It takes the address's next nonce from the chain index and adds its verified
+// transactions waiting in the transaction pool.
+func (bc *BlockchainCore) GetNextNonce(address string) uint64 {
+	nonce := bc.index.NextNonce(address)
+
+	for _, txn := range bc.TransactionPool {
+		if txn.Status == constants.TRANSACTION_VERIFY_SUCCESS && txn.From == address {
+			nonce++
+		}
+	}
+
+	return nonce
 }
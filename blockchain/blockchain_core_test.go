@@ -0,0 +1,78 @@
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/SunTzu71/suntzu_blockchain/constants"
+)
+
+func TestAddTransactionToTransactionPool(t *testing.T) {
+	sender := newTestKey(t)
+	const receiver = "receiver"
+
+	tests := []struct {
+		name      string
+		txn       func(pooled *Transaction) *Transaction
+		wantValid bool
+		wantPool  int
+		wantState string
+	}{
+		{"next nonce within balance", func(pooled *Transaction) *Transaction {
+			return sender.transfer(t, receiver, 300, 10, 1)
+		}, true, 2, constants.TRANSACTION_VERIFY_SUCCESS},
+		{"balance spent by the pool", func(pooled *Transaction) *Transaction {
+			return sender.transfer(t, receiver, 600, 10, 1)
+		}, true, 1, constants.TRANSACTION_VERIFY_FAILED},
+		{"nonce already used", func(pooled *Transaction) *Transaction {
+			return sender.transfer(t, receiver, 100, 10, 0)
+		}, true, 1, constants.TRANSACTION_VERIFY_FAILED},
+		{"nonce gap", func(pooled *Transaction) *Transaction {
+			return sender.transfer(t, receiver, 100, 10, 2)
+		}, true, 1, constants.TRANSACTION_VERIFY_FAILED},
+		{"invalid signature", func(pooled *Transaction) *Transaction {
+			txn := sender.transfer(t, receiver, 100, 10, 1)
+			txn.Signature = sender.transfer(t, receiver, 200, 10, 1).Signature
+			return txn
+		}, false, 1, constants.TRANSACTION_VERIFY_FAILED},
+		{"already pooled", func(pooled *Transaction) *Transaction {
+			copied := *pooled
+			return &copied
+		}, true, 1, constants.PENDING},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bc := testFundedBlockchain(sender.address, 1000)
+			pooled := sender.transfer(t, receiver, 600, 10, 0)
+			if !bc.AddTransactionToTransactionPool(pooled) || len(bc.TransactionPool) != 1 {
+				t.Fatal("first transaction was not pooled")
+			}
+
+			txn := tt.txn(pooled)
+			txn.Status = constants.PENDING
+			if valid := bc.AddTransactionToTransactionPool(txn); valid != tt.wantValid {
+				t.Errorf("AddTransactionToTransactionPool() = %v, want %v", valid, tt.wantValid)
+			}
+
+			if len(bc.TransactionPool) != tt.wantPool {
+				t.Errorf("pool holds %d transactions, want %d", len(bc.TransactionPool), tt.wantPool)
+			}
+			if txn.Status != tt.wantState {
+				t.Errorf("status = %q, want %q", txn.Status, tt.wantState)
+			}
+		})
+	}
+}
+
+func TestAddTransactionToTransactionPoolRejectsMinedTransaction(t *testing.T) {
+	sender := newTestKey(t)
+	bc := testFundedBlockchain(sender.address, 1000)
+	txn := sender.transfer(t, "receiver", 600, 10, 0)
+	bc.AddBlock(testMineBlock(bc.Blocks, []*Transaction{txn}, "miner"))
+
+	bc.AddTransactionToTransactionPool(txn)
+
+	if len(bc.TransactionPool) != 0 {
+		t.Errorf("pool holds %d transactions, want 0", len(bc.TransactionPool))
+	}
+}
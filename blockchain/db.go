@@ -2,70 +2,393 @@ package blockchain
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/SunTzu71/suntzu_blockchain/constants"
 	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
 )
 
-// DBAddBlockchain: saves the blockchain core state to the database
-// It takes a BlockchainCore struct and stores it as JSON in LevelDB
-// Returns an error if database operations fail
-func DBAddBlockchain(bs BlockchainCore) error {
-	db, err := leveldb.OpenFile(constants.BLOCKCHAIN_DB_PATH, nil)
+// Storage layout: every block is stored on its own under its height and indexed by its hash, and every
+// transaction of the pool under its position in the pool, while the tip height, peers, node address,
+// banned peers and the snapshot the chain was bootstrapped from are stored under separate keys.
+// Connecting a block therefore only writes the new block, its index and the pool, and admitting
+// a transaction to the pool only writes that transaction.
+const (
+	blockHeightPrefix = "block:height:"
+	blockHashPrefix   = "block:hash:"
+	poolPrefix        = "pool:"
+	tipKey            = "chain:tip"
+	peersKey          = "chain:peers"
+	addressKey        = "chain:address"
+	baseSnapshotKey   = "chain:base-snapshot"
+	bansKey           = "chain:bans"
+)
+
+// LevelDBStore is a Store backed by a LevelDB database on disk
+type LevelDBStore struct {
+	db *leveldb.DB
+}
+
+// NewLevelDBStore: opens or creates the LevelDB database at path
+// Returns an error if the database cannot be opened
+func NewLevelDBStore(path string) (*LevelDBStore, error) {
+	db, err := leveldb.OpenFile(path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LevelDBStore{db: db}, nil
+}
+
+// Close: closes the database
+func (ls *LevelDBStore) Close() error {
+	return ls.db.Close()
+}
+
+// blockHeightKey: returns the key of the block at a height, zero padded so keys sort by height
+func blockHeightKey(height uint64) []byte {
+	return []byte(fmt.Sprintf("%s%020d", blockHeightPrefix, height))
+}
+
+// blockHashKey: returns the key mapping a block hash to its height
+func blockHashKey(hash string) []byte {
+	return []byte(blockHashPrefix + hash)
+}
+
+// poolKey: returns the key of the pool transaction at a position, zero padded so keys sort by position
+func poolKey(position uint64) []byte {
+	return []byte(fmt.Sprintf("%s%020d", poolPrefix, position))
+}
+
+// putJson: marshals a value to JSON and adds it to the batch under key
+func putJson(batch *leveldb.Batch, key []byte, v any) error {
+	value, err := json.Marshal(v)
 	if err != nil {
 		return err
 	}
-	defer db.Close()
 
-	// Save to database
-	value, err := json.Marshal(bs)
+	batch.Put(key, value)
+
+	return nil
+}
+
+// putBlock: adds a block and its hash index to the batch
+func putBlock(batch *leveldb.Batch, b *Block) error {
+	err := putJson(batch, blockHeightKey(b.BlockNumber), b)
 	if err != nil {
 		return err
 	}
 
-	err = db.Put([]byte(constants.BLOCKCHAIN_KEY), value, nil)
+	batch.Put(blockHashKey(b.Hash()), []byte(strconv.FormatUint(b.BlockNumber, 10)))
+
+	return nil
+}
+
+// putPool: adds the deletion of the stored pool transactions and the transactions of pool to the batch
+func (ls *LevelDBStore) putPool(batch *leveldb.Batch, pool []*Transaction) error {
+	iter := ls.db.NewIterator(util.BytesPrefix([]byte(poolPrefix)), nil)
+	for iter.Next() {
+		batch.Delete(append([]byte{}, iter.Key()...))
+	}
+	iter.Release()
+	err := iter.Error()
 	if err != nil {
 		return err
 	}
 
+	for i, txn := range pool {
+		err = putJson(batch, poolKey(uint64(i)), txn)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
-// DBGetBlockchain: retrieves the blockchain core state from the database
-// It opens the LevelDB database, gets the blockchain data, and unmarshals it into a BlockchainCore struct
-// Returns a pointer to the BlockchainCore struct and any error that occurs
-func DBGetBlockchain() (*BlockchainCore, error) {
-	db, err := leveldb.OpenFile(constants.BLOCKCHAIN_DB_PATH, nil)
+// SaveBlockchain: saves the whole blockchain core state to the database
+// Every block, the tip, transaction pool, peers and address are written in a single batch
+// Returns an error if database operations fail
+func (ls *LevelDBStore) SaveBlockchain(bs *BlockchainCore) error {
+	batch := new(leveldb.Batch)
+	for _, block := range bs.Blocks {
+		err := putBlock(batch, block)
+		if err != nil {
+			return err
+		}
+	}
+
+	batch.Put([]byte(tipKey), []byte(strconv.FormatUint(bs.Blocks[len(bs.Blocks)-1].BlockNumber, 10)))
+	batch.Put([]byte(addressKey), []byte(bs.Address))
+
+	err := ls.putPool(batch, bs.TransactionPool)
+	if err != nil {
+		return err
+	}
+
+	err = putJson(batch, []byte(peersKey), bs.Peers)
+	if err != nil {
+		return err
+	}
+
+	if bs.BaseSnapshot != nil {
+		err = putJson(batch, []byte(baseSnapshotKey), bs.BaseSnapshot)
+		if err != nil {
+			return err
+		}
+	} else {
+		batch.Delete([]byte(baseSnapshotKey))
+	}
+
+	return ls.db.Write(batch, nil)
+}
+
+// ConnectBlock: saves a block connected on top of the tip together with the updated
+// transaction pool in one atomic batch
+// Returns an error if database operations fail
+func (ls *LevelDBStore) ConnectBlock(b *Block, pool []*Transaction) error {
+	batch := new(leveldb.Batch)
+	err := putBlock(batch, b)
+	if err != nil {
+		return err
+	}
+
+	batch.Put([]byte(tipKey), []byte(strconv.FormatUint(b.BlockNumber, 10)))
+
+	err = ls.putPool(batch, pool)
+	if err != nil {
+		return err
+	}
+
+	return ls.db.Write(batch, nil)
+}
+
+// Reorganize: replaces the stored blocks from forkIndex up to oldLength-1 with the connected blocks
+// and saves the updated transaction pool in one atomic batch. The hash index entries of the
+// disconnected blocks are removed.
+// Returns an error if database operations fail
+func (ls *LevelDBStore) Reorganize(forkIndex uint64, oldLength uint64, connected []*Block, pool []*Transaction) error {
+	batch := new(leveldb.Batch)
+	for height := forkIndex; height < oldLength; height++ {
+		block, err := ls.getBlock(height)
+		if err != nil {
+			return err
+		}
+
+		batch.Delete(blockHeightKey(height))
+		batch.Delete(blockHashKey(block.Hash()))
+	}
+
+	for _, block := range connected {
+		err := putBlock(batch, block)
+		if err != nil {
+			return err
+		}
+	}
+
+	tip := forkIndex - 1 + uint64(len(connected))
+	batch.Put([]byte(tipKey), []byte(strconv.FormatUint(tip, 10)))
+
+	err := ls.putPool(batch, pool)
+	if err != nil {
+		return err
+	}
+
+	return ls.db.Write(batch, nil)
+}
+
+// AddPoolTransaction: saves a transaction appended to the transaction pool after the last stored one
+// Returns an error if database operations fail
+func (ls *LevelDBStore) AddPoolTransaction(txn *Transaction) error {
+	var position uint64 = 0
+	iter := ls.db.NewIterator(util.BytesPrefix([]byte(poolPrefix)), nil)
+	if iter.Last() {
+		last, err := strconv.ParseUint(strings.TrimPrefix(string(iter.Key()), poolPrefix), 10, 64)
+		if err != nil {
+			iter.Release()
+			return err
+		}
+		position = last + 1
+	}
+	iter.Release()
+	err := iter.Error()
 	if err != nil {
+		return err
+	}
+
+	value, err := json.Marshal(txn)
+	if err != nil {
+		return err
+	}
+
+	return ls.db.Put(poolKey(position), value, nil)
+}
+
+// SavePeers: saves the peers map
+// Returns an error if database operations fail
+func (ls *LevelDBStore) SavePeers(peers map[string]bool) error {
+	value, err := json.Marshal(peers)
+	if err != nil {
+		return err
+	}
+
+	return ls.db.Put([]byte(peersKey), value, nil)
+}
+
+// LoadBans: reads the banned peers
+// Returns an empty list if no bans were saved and an error if database operations fail
+func (ls *LevelDBStore) LoadBans() ([]PeerBan, error) {
+	bans := []PeerBan{}
+	err := ls.getJson(bansKey, &bans)
+	if err != nil && err != leveldb.ErrNotFound {
 		return nil, err
 	}
-	defer db.Close()
 
-	data, err := db.Get([]byte(constants.BLOCKCHAIN_KEY), nil)
+	return bans, nil
+}
+
+// SaveBans: saves the banned peers
+// Returns an error if database operations fail
+func (ls *LevelDBStore) SaveBans(bans []PeerBan) error {
+	value, err := json.Marshal(bans)
+	if err != nil {
+		return err
+	}
+
+	return ls.db.Put([]byte(bansKey), value, nil)
+}
+
+// getBlock: reads the block stored at a height
+func (ls *LevelDBStore) getBlock(height uint64) (*Block, error) {
+	data, err := ls.db.Get(blockHeightKey(height), nil)
 	if err != nil {
 		return nil, err
 	}
 
-	var bs BlockchainCore
-	err = json.Unmarshal(data, &bs)
+	var block Block
+	err = json.Unmarshal(data, &block)
 	if err != nil {
 		return nil, err
 	}
 
-	return &bs, nil
+	return &block, nil
+}
+
+// getJson: reads the value stored under key and unmarshals it into v
+func (ls *LevelDBStore) getJson(key string, v any) error {
+	data, err := ls.db.Get([]byte(key), nil)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
 }
 
-func DBKeyExists() bool {
-	db, err := leveldb.OpenFile(constants.BLOCKCHAIN_DB_PATH, nil)
+// Load: retrieves the blockchain core state from the database
+// It reads every block up to the stored tip along with the pool transactions, peers, address and base snapshot.
+// A database still holding the whole state as one JSON value under BLOCKCHAIN_KEY is refused, see checkLegacy.
+// Returns a pointer to the BlockchainCore struct and any error that occurs
+func (ls *LevelDBStore) Load() (*BlockchainCore, error) {
+	err := ls.checkLegacy()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ls.db.Get([]byte(tipKey), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	tip, err := strconv.ParseUint(string(data), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	bs := new(BlockchainCore)
+	bs.Blocks = []*Block{}
+	for height := uint64(0); height <= tip; height++ {
+		block, err := ls.getBlock(height)
+		if err != nil {
+			return nil, err
+		}
+		bs.Blocks = append(bs.Blocks, block)
+	}
+
+	bs.TransactionPool, err = ls.loadPool()
 	if err != nil {
-		return false
+		return nil, err
 	}
-	defer db.Close()
 
-	exists, err := db.Has([]byte(constants.BLOCKCHAIN_KEY), nil)
+	err = ls.getJson(peersKey, &bs.Peers)
 	if err != nil {
-		return false
+		return nil, err
+	}
+
+	address, err := ls.db.Get([]byte(addressKey), nil)
+	if err != nil {
+		return nil, err
+	}
+	bs.Address = string(address)
+
+	exists, err := ls.db.Has([]byte(baseSnapshotKey), nil)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		err = ls.getJson(baseSnapshotKey, &bs.BaseSnapshot)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return bs, nil
+}
+
+// loadPool: reads the stored pool transactions in order
+func (ls *LevelDBStore) loadPool() ([]*Transaction, error) {
+	pool := []*Transaction{}
+	iter := ls.db.NewIterator(util.BytesPrefix([]byte(poolPrefix)), nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		txn := new(Transaction)
+		err := json.Unmarshal(iter.Value(), txn)
+		if err != nil {
+			return nil, err
+		}
+		pool = append(pool, txn)
+	}
+
+	return pool, iter.Error()
+}
+
+// checkLegacy: fails when the database was written by a version that kept the whole state as one JSON
+// value under BLOCKCHAIN_KEY. Those blocks predate chain IDs and the canonical block encoding, so they
+// can never match our genesis block and the database cannot be migrated.
+func (ls *LevelDBStore) checkLegacy() error {
+	exists, err := ls.db.Has([]byte(constants.BLOCKCHAIN_KEY), nil)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return errors.New("database was written by an older version and cannot be loaded, remove it and sync again")
+	}
+
+	return nil
+}
+
+// Exists: reports whether the database holds a blockchain, in either layout
+func (ls *LevelDBStore) Exists() bool {
+	for _, key := range []string{tipKey, constants.BLOCKCHAIN_KEY} {
+		exists, err := ls.db.Has([]byte(key), nil)
+		if err == nil && exists {
+			return true
+		}
 	}
 
-	return exists
+	return false
 }
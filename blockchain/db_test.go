@@ -0,0 +1,138 @@
+package blockchain
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/SunTzu71/suntzu_blockchain/constants"
+)
+
+// testLevelDBStore opens the LevelDB store at path, closing it when the test ends
+func testLevelDBStore(t *testing.T, path string) *LevelDBStore {
+	store, err := NewLevelDBStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	return store
+}
+
+// testReopen closes the store at path and loads the blockchain back from a newly opened one
+func testReopen(t *testing.T, store *LevelDBStore, path string) (*LevelDBStore, *BlockchainCore) {
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	store = testLevelDBStore(t, path)
+	bc, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	return store, bc
+}
+
+// testSameBlocks fails the test unless both chains hold blocks with the same hashes
+func testSameBlocks(t *testing.T, got []*Block, want []*Block) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("loaded %d blocks, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].Hash() != want[i].Hash() {
+			t.Errorf("block %d = %s, want %s", i, got[i].Hash(), want[i].Hash())
+		}
+	}
+}
+
+func TestLevelDBStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chain")
+	store := testLevelDBStore(t, path)
+	if store.Exists() {
+		t.Fatal("Exists() = true for an empty database")
+	}
+
+	bc := testBlockchain(2, "miner")
+	bc.Address = "node"
+	bc.Peers = map[string]bool{"http://peer": true}
+	if err := store.SaveBlockchain(bc); err != nil {
+		t.Fatal(err)
+	}
+
+	chain := testExtendChain(bc.Blocks, 1, "miner")
+	pool := testTransactions(3)
+	if err := store.ConnectBlock(chain[3], pool[:2]); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AddPoolTransaction(pool[2]); err != nil {
+		t.Fatal(err)
+	}
+
+	store, loaded := testReopen(t, store, path)
+	testSameBlocks(t, loaded.Blocks, chain)
+	if len(loaded.TransactionPool) != len(pool) {
+		t.Fatalf("loaded %d pool transactions, want %d", len(loaded.TransactionPool), len(pool))
+	}
+	for i, txn := range pool {
+		if loaded.TransactionPool[i].TransactionHash != txn.TransactionHash {
+			t.Errorf("pool transaction %d = %s, want %s", i, loaded.TransactionPool[i].TransactionHash, txn.TransactionHash)
+		}
+	}
+	if loaded.Address != "node" || !loaded.Peers["http://peer"] {
+		t.Errorf("loaded address %q and peers %v", loaded.Address, loaded.Peers)
+	}
+
+	// Replace blocks 2 and 3 with a longer fork
+	fork := testExtendChain(chain[:2], 3, "other")
+	if err := store.Reorganize(2, 4, fork[2:], []*Transaction{}); err != nil {
+		t.Fatal(err)
+	}
+
+	store, loaded = testReopen(t, store, path)
+	testSameBlocks(t, loaded.Blocks, fork)
+	if len(loaded.TransactionPool) != 0 {
+		t.Errorf("loaded %d pool transactions, want 0", len(loaded.TransactionPool))
+	}
+	for _, block := range chain[2:] {
+		if exists, _ := store.db.Has(blockHashKey(block.Hash()), nil); exists {
+			t.Errorf("hash index of disconnected block %d was kept", block.BlockNumber)
+		}
+	}
+}
+
+func TestLevelDBStoreRefusesLegacyDatabase(t *testing.T) {
+	store := testLevelDBStore(t, filepath.Join(t.TempDir(), "chain"))
+	if err := store.db.Put([]byte(constants.BLOCKCHAIN_KEY), []byte(`{"blocks":[]}`), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if !store.Exists() {
+		t.Error("Exists() = false for a legacy database")
+	}
+	if _, err := store.Load(); err == nil {
+		t.Error("Load() error = nil, want an error")
+	}
+}
+
+func TestStoreKeysSortNumerically(t *testing.T) {
+	tests := []struct {
+		name string
+		key  func(uint64) []byte
+	}{
+		{"block height", blockHeightKey},
+		{"pool position", poolKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, pair := range [][2]uint64{{0, 1}, {9, 10}, {99, 1000}} {
+				if bytes.Compare(tt.key(pair[0]), tt.key(pair[1])) >= 0 {
+					t.Errorf("key of %d does not sort before key of %d", pair[0], pair[1])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package blockchain
+
+import (
+	"strings"
+
+	"github.com/SunTzu71/suntzu_blockchain/constants"
+)
+
+// NextDifficulty: computes the mining difficulty required for the block following the given chain.
+// The chain must be a contiguous run of blocks ending with the parent of the new block.
+// Every DIFFICULTY_ADJUSTMENT_INTERVAL blocks the time taken by the previous interval is compared
+// against TARGET_BLOCK_TIME; the difficulty is raised by one when blocks came in too fast and
+// lowered by one when they came in too slow. Between retargets the parent's difficulty is kept.
+func NextDifficulty(chain []*Block) int {
+	parent := chain[len(chain)-1]
+	height := parent.BlockNumber + 1
+
+	if height%constants.DIFFICULTY_ADJUSTMENT_INTERVAL != 0 || len(chain) < constants.DIFFICULTY_ADJUSTMENT_INTERVAL {
+		return parent.Difficulty
+	}
+
+	// The genesis timestamp is not produced by mining so it is left out of the measurement
+	first := chain[len(chain)-constants.DIFFICULTY_ADJUSTMENT_INTERVAL]
+	if first.BlockNumber == 0 {
+		return parent.Difficulty
+	}
+
+	actualTime := parent.Timestamp - first.Timestamp
+	targetTime := int64(constants.TARGET_BLOCK_TIME * (constants.DIFFICULTY_ADJUSTMENT_INTERVAL - 1))
+
+	difficulty := parent.Difficulty
+	if actualTime*constants.DIFFICULTY_ADJUSTMENT_THRESHOLD < targetTime {
+		difficulty++
+	} else if actualTime > targetTime*constants.DIFFICULTY_ADJUSTMENT_THRESHOLD {
+		difficulty--
+	}
+
+	if difficulty < constants.MIN_MINING_DIFFICULTY {
+		difficulty = constants.MIN_MINING_DIFFICULTY
+	}
+	if difficulty > constants.MAX_MINING_DIFFICULTY {
+		difficulty = constants.MAX_MINING_DIFFICULTY
+	}
+
+	return difficulty
+}
+
+// meetsDifficulty: reports whether a block hash has at least difficulty leading zeros
+// after the hex prefix
+func meetsDifficulty(hash string, difficulty int) bool {
+	if len(hash) < len(constants.HEX_PREFIX)+difficulty {
+		return false
+	}
+
+	prefixLen := len(constants.HEX_PREFIX)
+	return hash[prefixLen:prefixLen+difficulty] == strings.Repeat("0", difficulty)
+}
@@ -0,0 +1,64 @@
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/SunTzu71/suntzu_blockchain/constants"
+)
+
+// testTimedChain returns a chain of length blocks at the given difficulty, stamped spacing seconds apart
+func testTimedChain(length int, spacing int64, difficulty int) []*Block {
+	chain := []*Block{}
+	for i := 0; i < length; i++ {
+		block := NewBlock("0x0", 0, uint64(i), difficulty)
+		block.Timestamp = int64(i) * spacing
+		chain = append(chain, block)
+	}
+
+	return chain
+}
+
+func TestNextDifficulty(t *testing.T) {
+	interval := int(constants.DIFFICULTY_ADJUSTMENT_INTERVAL)
+	tests := []struct {
+		name  string
+		chain []*Block
+		want  int
+	}{
+		{"between retargets", testTimedChain(interval+3, 1, 5), 5},
+		{"first interval after genesis", testTimedChain(interval, 1, 5), 5},
+		{"blocks too fast", testTimedChain(2*interval, 1, 5), 6},
+		{"blocks on target", testTimedChain(2*interval, constants.TARGET_BLOCK_TIME, 5), 5},
+		{"blocks too slow", testTimedChain(2*interval, 100*constants.TARGET_BLOCK_TIME, 5), 4},
+		{"never below the minimum", testTimedChain(2*interval, 100*constants.TARGET_BLOCK_TIME, constants.MIN_MINING_DIFFICULTY), constants.MIN_MINING_DIFFICULTY},
+		{"never above the maximum", testTimedChain(2*interval, 1, constants.MAX_MINING_DIFFICULTY), constants.MAX_MINING_DIFFICULTY},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NextDifficulty(tt.chain); got != tt.want {
+				t.Errorf("NextDifficulty() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMeetsDifficulty(t *testing.T) {
+	tests := []struct {
+		hash       string
+		difficulty int
+		want       bool
+	}{
+		{"0x000abc", 3, true},
+		{"0x000abc", 2, true},
+		{"0x000abc", 4, false},
+		{"0xabc000", 1, false},
+		{"0x00", 3, false},
+	}
+
+	for _, tt := range tests {
+		if got := meetsDifficulty(tt.hash, tt.difficulty); got != tt.want {
+			t.Errorf("meetsDifficulty(%q, %d) = %v, want %v", tt.hash, tt.difficulty, got, tt.want)
+		}
+	}
+}
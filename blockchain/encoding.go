@@ -0,0 +1,87 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+
+	"github.com/SunTzu71/suntzu_blockchain/constants"
+)
+
+// The canonical encoding is a version byte followed by the fields in a fixed order.
+// Integers are written as 8 byte big-endian values and strings and byte slices are
+// written as a 4 byte big-endian length followed by their bytes. Node-local fields
+// such as Status, and the signature itself, are never part of the signing payload.
+
+// writeUint64: writes an integer as 8 big-endian bytes
+func writeUint64(buf *bytes.Buffer, v uint64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	buf.Write(b[:])
+}
+
+// writeBytes: writes a byte slice prefixed with its length as 4 big-endian bytes
+func writeBytes(buf *bytes.Buffer, v []byte) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], uint32(len(v)))
+	buf.Write(b[:])
+	buf.Write(v)
+}
+
+// writeString: writes a string prefixed with its length as 4 big-endian bytes
+func writeString(buf *bytes.Buffer, v string) {
+	writeBytes(buf, []byte(v))
+}
+
+// SigningPayload returns the canonical binary encoding of the transaction fields covered by
+// its signature and hash: ChainID, From, To, Value, Fee, Nonce, Data and Timestamp
+func (t Transaction) SigningPayload() []byte {
+	buf := new(bytes.Buffer)
+	buf.WriteByte(constants.TRANSACTION_ENCODING_VERSION)
+	writeString(buf, t.ChainID)
+	writeString(buf, t.From)
+	writeString(buf, t.To)
+	writeUint64(buf, t.Value)
+	writeUint64(buf, t.Fee)
+	writeUint64(buf, t.Nonce)
+	writeBytes(buf, t.Data)
+	writeUint64(buf, t.Timestamp)
+
+	return buf.Bytes()
+}
+
+// Encode returns the canonical binary encoding of the whole transaction as it is stored in a block:
+// the signing payload followed by TransactionHash, Status, PublicKey and Signature. Blocks commit to
+// this encoding through their Merkle root, so a block hash covers the status and signature of every transaction.
+func (t Transaction) Encode() []byte {
+	buf := bytes.NewBuffer(t.SigningPayload())
+	writeString(buf, t.TransactionHash)
+	writeString(buf, t.Status)
+	writeString(buf, t.PublicKey)
+	writeBytes(buf, t.Signature)
+
+	return buf.Bytes()
+}
+
+// SigningHash returns the SHA-256 hash of the transaction's signing payload.
+// This is the digest signed by wallets and verified by nodes.
+func (t Transaction) SigningHash() [32]byte {
+	return sha256.Sum256(t.SigningPayload())
+}
+
+// Encode returns the canonical binary encoding of the header fields: ChainID, BlockNumber, PrevHash,
+// Timestamp, Nonce, Difficulty, CoinbaseMaturity and MerkleRoot
+func (h BlockHeader) Encode() []byte {
+	buf := new(bytes.Buffer)
+	buf.WriteByte(constants.BLOCK_ENCODING_VERSION)
+	writeString(buf, h.ChainID)
+	writeUint64(buf, h.BlockNumber)
+	writeString(buf, h.PrevHash)
+	writeUint64(buf, uint64(h.Timestamp))
+	writeUint64(buf, uint64(h.Nonce))
+	writeUint64(buf, uint64(h.Difficulty))
+	writeUint64(buf, h.CoinbaseMaturity)
+	writeString(buf, h.MerkleRoot)
+
+	return buf.Bytes()
+}
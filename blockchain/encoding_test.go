@@ -0,0 +1,100 @@
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/SunTzu71/suntzu_blockchain/constants"
+)
+
+func TestSigningPayload(t *testing.T) {
+	key := newTestKey(t)
+
+	tests := []struct {
+		name       string
+		change     func(txn *Transaction)
+		wantSigned bool
+	}{
+		{"chain ID", func(txn *Transaction) { txn.ChainID = "other-chain" }, true},
+		{"receiver", func(txn *Transaction) { txn.To = "thief" }, true},
+		{"value", func(txn *Transaction) { txn.Value++ }, true},
+		{"fee", func(txn *Transaction) { txn.Fee++ }, true},
+		{"nonce", func(txn *Transaction) { txn.Nonce++ }, true},
+		{"data", func(txn *Transaction) { txn.Data = []byte("memo") }, true},
+		{"timestamp", func(txn *Transaction) { txn.Timestamp++ }, true},
+		{"status", func(txn *Transaction) { txn.Status = constants.SUCCESS }, false},
+		{"signature", func(txn *Transaction) { txn.Signature = append([]byte{}, txn.Signature[1:]...) }, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			txn := key.transfer(t, "receiver", 100, 1, 0)
+			payload, encoding := txn.SigningPayload(), txn.Encode()
+
+			tt.change(txn)
+
+			if signed := !bytes.Equal(payload, txn.SigningPayload()); signed != tt.wantSigned {
+				t.Errorf("signing payload changed = %v, want %v", signed, tt.wantSigned)
+			}
+			if bytes.Equal(encoding, txn.Encode()) {
+				t.Error("stored encoding did not change")
+			}
+
+			// A signed field cannot be changed even when the hash is recomputed
+			if tt.wantSigned {
+				txn.TransactionHash = txn.Hash()
+				if txn.VerifyTransaction() {
+					t.Error("VerifyTransaction() = true after changing a signed field")
+				}
+			}
+		})
+	}
+}
+
+func TestSigningPayloadIsLengthPrefixed(t *testing.T) {
+	a := NewTransaction("ab", "c", 1, 0, 0, []byte{})
+	b := NewTransaction("a", "bc", 1, 0, 0, []byte{})
+	b.Timestamp = a.Timestamp
+
+	if bytes.Equal(a.SigningPayload(), b.SigningPayload()) {
+		t.Error("payloads of different sender and receiver splits are equal")
+	}
+}
+
+func TestBlockHeaderEncode(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(b *Block)
+	}{
+		{"chain ID", func(b *Block) { b.ChainID = "other-chain" }},
+		{"block number", func(b *Block) { b.BlockNumber++ }},
+		{"previous hash", func(b *Block) { b.PrevHash = "0x1" }},
+		{"timestamp", func(b *Block) { b.Timestamp++ }},
+		{"nonce", func(b *Block) { b.Nonce++ }},
+		{"difficulty", func(b *Block) { b.Difficulty++ }},
+		{"coinbase maturity", func(b *Block) { b.CoinbaseMaturity++ }},
+		{"transactions through the Merkle root", func(b *Block) {
+			b.Transactions = testTransactions(1)
+			b.MerkleRoot = b.CalculateMerkleRoot()
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBlock("0x0", 0, 1, 1)
+			hash := b.Hash()
+
+			tt.change(b)
+
+			if b.Hash() == hash {
+				t.Error("block hash did not change")
+			}
+		})
+	}
+}
+
+func TestBlockHeaderEncodeStartsWithVersion(t *testing.T) {
+	if version := NewBlock("0x0", 0, 1, 1).Header().Encode()[0]; version != constants.BLOCK_ENCODING_VERSION {
+		t.Errorf("encoding version = %d, want %d", version, constants.BLOCK_ENCODING_VERSION)
+	}
+}
@@ -0,0 +1,108 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/SunTzu71/suntzu_blockchain/constants"
+)
+
+// Genesis describes the first block of a network: when it was created, the chain ID,
+// the initial mining difficulty and the balances allocated to addresses before any mining.
+// It also carries the coinbase maturity, which every node of the network must agree on.
+type Genesis struct {
+	Timestamp        int64             `json:"timestamp"`
+	ChainID          string            `json:"chain_id"`
+	Difficulty       int               `json:"difficulty"`
+	CoinbaseMaturity uint64            `json:"coinbase_maturity"`
+	Alloc            map[string]uint64 `json:"alloc"`
+}
+
+// DefaultGenesis returns the genesis used when no genesis file is given: the configured chain ID,
+// GENESIS_TIMESTAMP, MINING_DIFFICULTY, DEFAULT_COINBASE_MATURITY and no pre-funded addresses
+func DefaultGenesis() *Genesis {
+	g := new(Genesis)
+	g.Timestamp = constants.GENESIS_TIMESTAMP
+	g.ChainID = constants.CHAIN_ID
+	g.Difficulty = constants.MINING_DIFFICULTY
+	g.CoinbaseMaturity = constants.DEFAULT_COINBASE_MATURITY
+	g.Alloc = map[string]uint64{}
+
+	return g
+}
+
+// LoadGenesis reads a genesis configuration from a JSON file. Missing timestamp, difficulty and
+// coinbase maturity fall back to the defaults, while the chain ID is required.
+// Returns an error if the file cannot be read or contains invalid values.
+func LoadGenesis(path string) (*Genesis, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	g := DefaultGenesis()
+	g.ChainID = ""
+	err = json.Unmarshal(data, g)
+	if err != nil {
+		return nil, err
+	}
+
+	if g.ChainID == "" {
+		return nil, fmt.Errorf("genesis file %s has no chain_id", path)
+	}
+
+	if g.Difficulty < constants.MIN_MINING_DIFFICULTY || g.Difficulty > constants.MAX_MINING_DIFFICULTY {
+		return nil, fmt.Errorf("genesis difficulty %d must be between %d and %d", g.Difficulty, constants.MIN_MINING_DIFFICULTY, constants.MAX_MINING_DIFFICULTY)
+	}
+
+	var supply uint64 = 0
+	for address, value := range g.Alloc {
+		if value == 0 {
+			return nil, fmt.Errorf("genesis allocation for %s must not be zero", address)
+		}
+		if value > constants.MAX_SUPPLY-supply {
+			return nil, fmt.Errorf("genesis allocations exceed the maximum supply of %d", constants.MAX_SUPPLY)
+		}
+		supply += value
+	}
+
+	return g, nil
+}
+
+// Block builds the genesis block described by the configuration. Every pre-funded address receives
+// a successful transaction from BLOCKCHAIN_ADDRESS, in address order, so the same configuration
+// always produces the same genesis hash. The coinbase maturity is committed in the header, so nodes
+// configured with a different maturity end up with a different genesis hash.
+func (g *Genesis) Block() *Block {
+	block := NewBlock("0x0", 0, 0, g.Difficulty)
+	block.ChainID = g.ChainID
+	block.CoinbaseMaturity = g.CoinbaseMaturity
+	block.Timestamp = g.Timestamp
+
+	addresses := []string{}
+	for address := range g.Alloc {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+
+	for _, address := range addresses {
+		txn := new(Transaction)
+		txn.ChainID = g.ChainID
+		txn.From = constants.BLOCKCHAIN_ADDRESS
+		txn.To = address
+		txn.Value = g.Alloc[address]
+		txn.Data = []byte{}
+		txn.Timestamp = uint64(g.Timestamp)
+		txn.Signature = []byte{}
+		txn.TransactionHash = txn.Hash()
+		txn.Status = constants.SUCCESS
+
+		block.Transactions = append(block.Transactions, txn)
+	}
+
+	block.MerkleRoot = block.CalculateMerkleRoot()
+
+	return block
+}
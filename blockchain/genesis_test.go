@@ -0,0 +1,109 @@
+package blockchain
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/SunTzu71/suntzu_blockchain/constants"
+)
+
+func TestLoadGenesis(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      string
+		wantErr     bool
+		wantDiff    int
+		wantBalance uint64
+	}{
+		{"allocations", `{"chain_id":"testnet","difficulty":2,"alloc":{"alice":500}}`, false, 2, 500},
+		{"defaults for missing fields", `{"chain_id":"testnet"}`, false, constants.MINING_DIFFICULTY, 0},
+		{"missing chain id", `{"difficulty":2}`, true, 0, 0},
+		{"difficulty below the minimum", `{"chain_id":"testnet","difficulty":0}`, true, 0, 0},
+		{"difficulty above the maximum", fmt.Sprintf(`{"chain_id":"testnet","difficulty":%d}`, constants.MAX_MINING_DIFFICULTY+1), true, 0, 0},
+		{"zero allocation", `{"chain_id":"testnet","alloc":{"alice":0}}`, true, 0, 0},
+		{"allocations above the supply cap", fmt.Sprintf(`{"chain_id":"testnet","alloc":{"alice":%d,"bob":1}}`, constants.MAX_SUPPLY), true, 0, 0},
+		{"invalid JSON", `{"chain_id":`, true, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "genesis.json")
+			if err := os.WriteFile(path, []byte(tt.config), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			g, err := LoadGenesis(path)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("LoadGenesis() error = nil, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadGenesis() error = %v", err)
+			}
+
+			if g.Difficulty != tt.wantDiff {
+				t.Errorf("difficulty = %d, want %d", g.Difficulty, tt.wantDiff)
+			}
+			if g.Alloc["alice"] != tt.wantBalance {
+				t.Errorf("alice allocation = %d, want %d", g.Alloc["alice"], tt.wantBalance)
+			}
+		})
+	}
+}
+
+func TestLoadGenesisMissingFile(t *testing.T) {
+	if _, err := LoadGenesis(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("LoadGenesis() error = nil, want an error")
+	}
+}
+
+func TestGenesisBlock(t *testing.T) {
+	base := func() *Genesis {
+		g := DefaultGenesis()
+		g.Alloc = map[string]uint64{"alice": 500, "bob": 300, "carol": 200}
+		return g
+	}
+
+	tests := []struct {
+		name      string
+		change    func(g *Genesis)
+		wantEqual bool
+	}{
+		{"same configuration", func(g *Genesis) {}, true},
+		{"chain id", func(g *Genesis) { g.ChainID = "testnet" }, false},
+		{"timestamp", func(g *Genesis) { g.Timestamp++ }, false},
+		{"difficulty", func(g *Genesis) { g.Difficulty++ }, false},
+		{"coinbase maturity", func(g *Genesis) { g.CoinbaseMaturity++ }, false},
+		{"allocation", func(g *Genesis) { g.Alloc["bob"]++ }, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := base()
+			tt.change(g)
+
+			if equal := base().Block().Hash() == g.Block().Hash(); equal != tt.wantEqual {
+				t.Errorf("genesis hashes equal = %v, want %v", equal, tt.wantEqual)
+			}
+		})
+	}
+}
+
+func TestGenesisBlockFundsAllocations(t *testing.T) {
+	g := DefaultGenesis()
+	g.Alloc = map[string]uint64{"alice": 500, "bob": 300}
+	bc := NewBlockchain(*g.Block(), "", NewMemoryStore())
+
+	for address, value := range g.Alloc {
+		if balance := bc.CalculateTotalCrypto(address); balance != value {
+			t.Errorf("balance of %s = %d, want %d", address, balance, value)
+		}
+	}
+	if supply := GenesisSupply(bc.Blocks[0]); supply != 800 {
+		t.Errorf("GenesisSupply() = %d, want 800", supply)
+	}
+}
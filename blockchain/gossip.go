@@ -0,0 +1,182 @@
+package blockchain
+
+import (
+	"log"
+	"sync"
+
+	"github.com/SunTzu71/suntzu_blockchain/constants"
+)
+
+// TransactionInventory announces the hashes of transactions added to a node's transaction pool.
+// Address is the announcing node, which peers request the transactions they are missing from.
+type TransactionInventory struct {
+	TransactionHashes []string `json:"transaction_hashes"`
+	Address           string   `json:"address"`
+}
+
+// peerQueue holds the transaction hashes waiting to be announced to one peer
+type peerQueue struct {
+	address   string
+	hashes    []string
+	scheduled bool
+}
+
+// transactionGossip relays transactions between peers without blocking the caller. Transaction hashes are
+// appended to a bounded outbound queue per peer, and a fixed pool of GOSSIP_WORKERS workers sends each
+// queued peer its pending hashes as one inventory. A peer is only handled by one worker at a time.
+// Peers then request the transactions they do not have with FetchPoolTransactions.
+type transactionGossip struct {
+	bc      *BlockchainCore
+	mutex   sync.Mutex
+	cond    *sync.Cond
+	once    sync.Once
+	queues  map[string]*peerQueue
+	pending []*peerQueue
+	seen    *seenCache
+}
+
+// newTransactionGossip creates the gossip state of a blockchain. The workers start with the first announcement.
+func newTransactionGossip(bc *BlockchainCore) *transactionGossip {
+	g := &transactionGossip{bc: bc, queues: map[string]*peerQueue{}, pending: []*peerQueue{}}
+	g.cond = sync.NewCond(&g.mutex)
+	g.seen = newSeenCache(constants.SEEN_TRANSACTION_CACHE_SIZE)
+
+	return g
+}
+
+// announce queues a transaction hash for every active peer except ourselves, the peer it came from and banned peers
+func (g *transactionGossip) announce(txnHash string, origin string) {
+	g.seen.add(txnHash)
+	g.once.Do(g.start)
+
+	for peer, status := range g.bc.GetPeers() {
+		if peer != g.bc.Address && peer != origin && status && !g.bc.IsPeerBanned(peer) {
+			g.enqueue(peer, txnHash)
+		}
+	}
+}
+
+// enqueue appends a transaction hash to a peer's queue and schedules the peer for a worker.
+// The hash is dropped if the queue already holds GOSSIP_QUEUE_SIZE hashes.
+func (g *transactionGossip) enqueue(peer string, txnHash string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	queue, ok := g.queues[peer]
+	if !ok {
+		queue = &peerQueue{address: peer, hashes: []string{}}
+		g.queues[peer] = queue
+	}
+
+	if len(queue.hashes) >= constants.GOSSIP_QUEUE_SIZE {
+		log.Println("Gossip queue full, dropping transaction", txnHash, "for peer:", peer)
+		return
+	}
+	queue.hashes = append(queue.hashes, txnHash)
+
+	if !queue.scheduled {
+		queue.scheduled = true
+		g.pending = append(g.pending, queue)
+		g.cond.Signal()
+	}
+}
+
+// start launches the gossip workers
+func (g *transactionGossip) start() {
+	for i := 0; i < constants.GOSSIP_WORKERS; i++ {
+		go g.worker()
+	}
+}
+
+// worker sends the pending hashes of scheduled peers, up to MAX_INVENTORY_HASHES per inventory.
+// A peer with hashes left afterwards is scheduled again behind the other peers.
+func (g *transactionGossip) worker() {
+	for {
+		g.mutex.Lock()
+		for len(g.pending) == 0 {
+			g.cond.Wait()
+		}
+		queue := g.pending[0]
+		g.pending = g.pending[1:]
+		count := min(len(queue.hashes), constants.MAX_INVENTORY_HASHES)
+		hashes := queue.hashes[:count:count]
+		queue.hashes = queue.hashes[count:]
+		g.mutex.Unlock()
+
+		inv := &TransactionInventory{TransactionHashes: hashes, Address: g.bc.Address}
+		g.bc.SendTransactionInventory(queue.address, inv)
+
+		g.mutex.Lock()
+		if len(queue.hashes) > 0 {
+			g.pending = append(g.pending, queue)
+			g.cond.Signal()
+		} else {
+			queue.scheduled = false
+		}
+		g.mutex.Unlock()
+	}
+}
+
+// ReceiveTransactionInventory: handles a transaction inventory announced by a peer. Inventories of peers we have
+// not handshaken with or that are banned, and hashes already seen, in the transaction pool or in the chain are ignored, the other transactions are
+// requested from the announcing peer and added to the transaction pool, which announces the verified ones to
+// our other peers in turn. The peer is penalized for failed requests and transactions with an invalid signature,
+// but not for transactions whose nonce or balance only fails against our own pool and chain.
+func (bc *BlockchainCore) ReceiveTransactionInventory(inv *TransactionInventory) {
+	if !bc.IsHandshakenPeer(inv.Address) || bc.IsPeerBanned(inv.Address) {
+		return
+	}
+
+	wanted := map[string]bool{}
+	hashes := []string{}
+	for _, txnHash := range inv.TransactionHashes {
+		if !bc.gossip.seen.add(txnHash) || bc.isTransactionInPool(txnHash) || bc.isTransactionInChain(txnHash) {
+			continue
+		}
+		wanted[txnHash] = true
+		hashes = append(hashes, txnHash)
+	}
+	if len(hashes) == 0 {
+		return
+	}
+
+	txns, err := FetchPoolTransactions(inv.Address, hashes)
+	if err != nil {
+		log.Println("Error while fetching transactions from peer:", inv.Address, "Error:", err.Error())
+		bc.penalizeError(inv.Address, err)
+		for _, txnHash := range hashes {
+			bc.gossip.seen.remove(txnHash)
+		}
+		return
+	}
+
+	for _, txn := range txns {
+		if !wanted[txn.TransactionHash] {
+			continue
+		}
+		delete(wanted, txn.TransactionHash)
+		if !bc.addTransaction(txn, inv.Address) {
+			bc.PenalizePeer(inv.Address, constants.INVALID_DATA_PENALTY, "invalid signature in transaction "+txn.TransactionHash)
+		}
+	}
+}
+
+// GetPoolTransactions: returns the verified transactions of the transaction pool with the given hashes
+func (bc *BlockchainCore) GetPoolTransactions(hashes []string) []*Transaction {
+	bc.mutex.Lock()
+	defer bc.mutex.Unlock()
+
+	wanted := map[string]bool{}
+	for _, txnHash := range hashes {
+		wanted[txnHash] = true
+	}
+
+	txns := []*Transaction{}
+	for _, txn := range bc.TransactionPool {
+		if wanted[txn.TransactionHash] && txn.Status == constants.TRANSACTION_VERIFY_SUCCESS {
+			txns = append(txns, txn)
+		}
+	}
+
+	return txns
+}
@@ -0,0 +1,104 @@
+package blockchain
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/SunTzu71/suntzu_blockchain/constants"
+)
+
+// testGossip returns a blockchain whose transaction gossip queues announcements without starting its workers
+func testGossip() *BlockchainCore {
+	bc := testBlockchain(0, "miner")
+	bc.gossip.once.Do(func() {})
+
+	return bc
+}
+
+func TestAnnounceQueuesActivePeers(t *testing.T) {
+	bc := testGossip()
+	bc.Address = "http://self"
+	bc.Peers = map[string]bool{
+		"http://self":     true,
+		"http://origin":   true,
+		"http://inactive": false,
+		"http://banned":   true,
+		"http://first":    true,
+		"http://second":   true,
+	}
+	if err := bc.BanPeer("http://banned", 60, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	bc.gossip.announce("0xtxn", "http://origin")
+
+	queued := []string{}
+	for peer, queue := range bc.gossip.queues {
+		if slices.Equal(queue.hashes, []string{"0xtxn"}) {
+			queued = append(queued, peer)
+		}
+	}
+	slices.Sort(queued)
+	if want := []string{"http://first", "http://second"}; !slices.Equal(queued, want) {
+		t.Errorf("queued for %v, want %v", queued, want)
+	}
+	if bc.gossip.seen.add("0xtxn") {
+		t.Error("announced transaction was not marked as seen")
+	}
+}
+
+func TestEnqueue(t *testing.T) {
+	tests := []struct {
+		name       string
+		count      int
+		wantQueued int
+	}{
+		{"one hash", 1, 1},
+		{"full queue", constants.GOSSIP_QUEUE_SIZE, constants.GOSSIP_QUEUE_SIZE},
+		{"hashes beyond the queue size are dropped", constants.GOSSIP_QUEUE_SIZE + 5, constants.GOSSIP_QUEUE_SIZE},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := testGossip().gossip
+			for i := 0; i < tt.count; i++ {
+				g.enqueue("http://peer", fmt.Sprintf("0x%d", i))
+			}
+
+			if queued := len(g.queues["http://peer"].hashes); queued != tt.wantQueued {
+				t.Errorf("queue holds %d hashes, want %d", queued, tt.wantQueued)
+			}
+			if len(g.pending) != 1 {
+				t.Errorf("peer scheduled %d times, want once", len(g.pending))
+			}
+		})
+	}
+}
+
+func TestReceiveTransactionInventoryIgnoresUnknownPeers(t *testing.T) {
+	bc := testGossip()
+	inv := &TransactionInventory{TransactionHashes: []string{"0xtxn"}, Address: "http://127.0.0.1:1"}
+
+	bc.ReceiveTransactionInventory(inv)
+
+	if !bc.gossip.seen.add("0xtxn") {
+		t.Error("inventory of a peer we have not handshaken with was processed")
+	}
+}
+
+func TestGetPoolTransactions(t *testing.T) {
+	sender := newTestKey(t)
+	bc := testFundedBlockchain(sender.address, 1000)
+	bc.gossip.once.Do(func() {})
+
+	pooled := sender.transfer(t, "receiver", 100, 1, 0)
+	bc.AddTransactionToTransactionPool(pooled)
+	dropped := sender.transfer(t, "receiver", 5000, 1, 1)
+	bc.AddTransactionToTransactionPool(dropped)
+
+	txns := bc.GetPoolTransactions([]string{pooled.TransactionHash, dropped.TransactionHash, "0xunknown"})
+	if len(txns) != 1 || txns[0].TransactionHash != pooled.TransactionHash {
+		t.Errorf("GetPoolTransactions() returned %d transactions, want only the pooled one", len(txns))
+	}
+}
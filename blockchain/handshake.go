@@ -0,0 +1,208 @@
+package blockchain
+
+import (
+	"fmt"
+	"log"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/SunTzu71/suntzu_blockchain/constants"
+)
+
+// Handshake is exchanged by nodes before they talk to each other, so peers on another chain,
+// with another genesis block or speaking an unsupported protocol version can be told apart.
+// SnapshotHeight is the height of the snapshot a node started from, or zero if it stores every block.
+type Handshake struct {
+	ProtocolVersion int    `json:"protocol_version"`
+	SoftwareVersion string `json:"software_version"`
+	ChainID         string `json:"chain_id"`
+	GenesisHash     string `json:"genesis_hash"`
+	BestHeight      uint64 `json:"best_height"`
+	BestHash        string `json:"best_hash"`
+	TotalWork       string `json:"total_work"`
+	SnapshotHeight  uint64 `json:"snapshot_height"`
+	Address         string `json:"address"`
+}
+
+// PeerInfo is the result of the last handshake with a peer. Compatible is false and Error holds
+// the reason when the handshake failed or the peer was rejected.
+type PeerInfo struct {
+	Address         string `json:"address"`
+	Compatible      bool   `json:"compatible"`
+	Error           string `json:"error,omitempty"`
+	ProtocolVersion int    `json:"protocol_version"`
+	SoftwareVersion string `json:"software_version"`
+	ChainID         string `json:"chain_id"`
+	GenesisHash     string `json:"genesis_hash"`
+	BestHeight      uint64 `json:"best_height"`
+	BestHash        string `json:"best_hash"`
+	TotalWork       string `json:"total_work"`
+	SnapshotHeight  uint64 `json:"snapshot_height"`
+	LastHandshake   int64  `json:"last_handshake"`
+}
+
+// peerBook keeps the result of the last handshake with every peer
+type peerBook struct {
+	mutex sync.Mutex
+	peers map[string]*PeerInfo
+}
+
+// newPeerBook creates an empty peer book
+func newPeerBook() *peerBook {
+	return &peerBook{peers: map[string]*PeerInfo{}}
+}
+
+// record stores the result of a handshake with the peer at address. h is nil if no handshake was received.
+func (pb *peerBook) record(address string, h *Handshake, err error) {
+	info := &PeerInfo{Address: address, Compatible: err == nil, LastHandshake: time.Now().Unix()}
+	if err != nil {
+		info.Error = err.Error()
+	}
+	if h != nil {
+		info.ProtocolVersion = h.ProtocolVersion
+		info.SoftwareVersion = h.SoftwareVersion
+		info.ChainID = h.ChainID
+		info.GenesisHash = h.GenesisHash
+		info.BestHeight = h.BestHeight
+		info.BestHash = h.BestHash
+		info.TotalWork = h.TotalWork
+		info.SnapshotHeight = h.SnapshotHeight
+	}
+
+	pb.mutex.Lock()
+	defer pb.mutex.Unlock()
+
+	pb.peers[address] = info
+}
+
+// compatible reports whether the last handshake with the peer at address succeeded
+func (pb *peerBook) compatible(address string) bool {
+	pb.mutex.Lock()
+	defer pb.mutex.Unlock()
+
+	info, ok := pb.peers[address]
+
+	return ok && info.Compatible
+}
+
+// snapshotHeight returns the snapshot height a compatible peer reported in its last handshake,
+// or zero if it stores every block or did not complete a handshake
+func (pb *peerBook) snapshotHeight(address string) uint64 {
+	pb.mutex.Lock()
+	defer pb.mutex.Unlock()
+
+	info, ok := pb.peers[address]
+	if !ok || !info.Compatible {
+		return 0
+	}
+
+	return info.SnapshotHeight
+}
+
+// list returns the recorded peers sorted by address
+func (pb *peerBook) list() []PeerInfo {
+	pb.mutex.Lock()
+	defer pb.mutex.Unlock()
+
+	peers := []PeerInfo{}
+	for _, info := range pb.peers {
+		peers = append(peers, *info)
+	}
+	sort.Slice(peers, func(i, j int) bool {
+		return peers[i].Address < peers[j].Address
+	})
+
+	return peers
+}
+
+// NewHandshake: returns our handshake describing the node's protocol, chain, tip and snapshot height
+func (bc *BlockchainCore) NewHandshake() *Handshake {
+	bc.mutex.Lock()
+	blocks := bc.Blocks
+	base := bc.BaseSnapshot
+	bc.mutex.Unlock()
+
+	var snapshotHeight uint64 = 0
+	if base != nil {
+		snapshotHeight = base.Height
+	}
+
+	tip := blocks[len(blocks)-1]
+	return &Handshake{
+		ProtocolVersion: constants.PROTOCOL_VERSION,
+		SoftwareVersion: constants.SOFTWARE_VERSION,
+		ChainID:         constants.CHAIN_ID,
+		GenesisHash:     blocks[0].Hash(),
+		BestHeight:      tip.BlockNumber,
+		BestHash:        tip.Hash(),
+		TotalWork:       ChainWork(blocks).String(),
+		SnapshotHeight:  snapshotHeight,
+		Address:         bc.Address,
+	}
+}
+
+// CheckHandshake: verifies that a peer's handshake is compatible with our node
+// Returns an error if the peer is banned, speaks a protocol version below MIN_PROTOCOL_VERSION, runs another
+// chain or genesis block, or reports an invalid total work
+func (bc *BlockchainCore) CheckHandshake(h *Handshake) error {
+	if bc.IsPeerBanned(h.Address) {
+		return fmt.Errorf("peer %s is banned", h.Address)
+	}
+
+	if h.ProtocolVersion < constants.MIN_PROTOCOL_VERSION {
+		return fmt.Errorf("protocol version %d is below the minimum %d", h.ProtocolVersion, constants.MIN_PROTOCOL_VERSION)
+	}
+
+	if h.ChainID != constants.CHAIN_ID {
+		return fmt.Errorf("chain id %q does not match %q", h.ChainID, constants.CHAIN_ID)
+	}
+
+	genesisHash := bc.GetBlocks()[0].Hash()
+	if h.GenesisHash != genesisHash {
+		return fmt.Errorf("genesis block %s does not match %s", h.GenesisHash, genesisHash)
+	}
+
+	_, ok := new(big.Int).SetString(h.TotalWork, 10)
+	if !ok {
+		return fmt.Errorf("invalid total work %q", h.TotalWork)
+	}
+
+	return nil
+}
+
+// AcceptHandshake: checks and records a handshake received from a peer
+// Returns an error if the peer is incompatible, see CheckHandshake
+func (bc *BlockchainCore) AcceptHandshake(h *Handshake) error {
+	err := bc.CheckHandshake(h)
+	bc.peerBook.record(h.Address, h, err)
+	if err != nil {
+		log.Println("Rejected handshake from peer:", h.Address, "Error:", err.Error())
+	}
+
+	return err
+}
+
+// HandshakePeer: exchanges handshakes with the peer at address and records the result
+// Returns an error if the peer could not be reached, rejected our handshake or is incompatible
+func (bc *BlockchainCore) HandshakePeer(address string) error {
+	h, err := SendHandshake(address, bc.NewHandshake())
+	if err == nil {
+		err = bc.CheckHandshake(h)
+	}
+	bc.peerBook.record(address, h, err)
+
+	return err
+}
+
+// IsHandshakenPeer: reports whether the last handshake with the peer at address succeeded. Block announcements
+// and transaction inventories are only acted on, and their senders only penalized, for handshaken peers.
+func (bc *BlockchainCore) IsHandshakenPeer(address string) bool {
+	return bc.peerBook.compatible(address)
+}
+
+// GetPeerInfo: returns the result of the last handshake with every peer, sorted by address
+func (bc *BlockchainCore) GetPeerInfo() []PeerInfo {
+	return bc.peerBook.list()
+}
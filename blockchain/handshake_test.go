@@ -0,0 +1,88 @@
+package blockchain
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/SunTzu71/suntzu_blockchain/constants"
+)
+
+func TestAcceptHandshake(t *testing.T) {
+	bc := testBlockchain(2, "miner")
+	if err := bc.BanPeer("http://banned", 60, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		change     func(h *Handshake)
+		wantReject bool
+	}{
+		{"same chain", func(h *Handshake) {}, false},
+		{"other tip and work", func(h *Handshake) {
+			h.BestHeight = 100
+			h.BestHash = "0xabc"
+			h.TotalWork = "123456789012345678901234567890"
+		}, false},
+		{"newer protocol version", func(h *Handshake) { h.ProtocolVersion++ }, false},
+		{"banned peer", func(h *Handshake) { h.Address = "http://banned" }, true},
+		{"protocol version below the minimum", func(h *Handshake) { h.ProtocolVersion = constants.MIN_PROTOCOL_VERSION - 1 }, true},
+		{"other chain", func(h *Handshake) { h.ChainID = "suntzuchain-testnet" }, true},
+		{"other genesis", func(h *Handshake) { h.GenesisHash = bc.Blocks[1].Hash() }, true},
+		{"invalid total work", func(h *Handshake) { h.TotalWork = "lots" }, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := bc.NewHandshake()
+			h.Address = "http://peer"
+			tt.change(h)
+
+			err := bc.AcceptHandshake(h)
+			if (err != nil) != tt.wantReject {
+				t.Fatalf("AcceptHandshake() error = %v, want error %v", err, tt.wantReject)
+			}
+			if handshaken := bc.IsHandshakenPeer(h.Address); handshaken == tt.wantReject {
+				t.Errorf("IsHandshakenPeer() = %v, want %v", handshaken, !tt.wantReject)
+			}
+		})
+	}
+}
+
+func TestNewHandshake(t *testing.T) {
+	bc := testBlockchain(2, "miner")
+	bc.Address = "http://self"
+
+	h := bc.NewHandshake()
+
+	if h.ChainID != constants.CHAIN_ID || h.GenesisHash != bc.Blocks[0].Hash() {
+		t.Errorf("handshake chain %q genesis %s, want %q %s", h.ChainID, h.GenesisHash, constants.CHAIN_ID, bc.Blocks[0].Hash())
+	}
+	if h.BestHeight != 2 || h.BestHash != bc.Blocks[2].Hash() {
+		t.Errorf("handshake tip %d %s, want 2 %s", h.BestHeight, h.BestHash, bc.Blocks[2].Hash())
+	}
+	if h.TotalWork != bc.TotalWork().String() || h.SnapshotHeight != 0 || h.Address != "http://self" {
+		t.Errorf("handshake work %s snapshot %d address %s", h.TotalWork, h.SnapshotHeight, h.Address)
+	}
+}
+
+func TestPeerBookSnapshotHeight(t *testing.T) {
+	pb := newPeerBook()
+	pb.record("http://compatible", &Handshake{SnapshotHeight: 1000}, nil)
+	pb.record("http://rejected", &Handshake{SnapshotHeight: 1000}, errors.New("chain id does not match"))
+
+	tests := []struct {
+		address string
+		want    uint64
+	}{
+		{"http://compatible", 1000},
+		{"http://rejected", 0},
+		{"http://unknown", 0},
+	}
+
+	for _, tt := range tests {
+		if got := pb.snapshotHeight(tt.address); got != tt.want {
+			t.Errorf("snapshotHeight(%q) = %d, want %d", tt.address, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package blockchain
+
+import (
+	"sync"
+
+	"github.com/SunTzu71/suntzu_blockchain/constants"
+)
+
+// IndexedTransaction is a transaction included in the chain together with its location
+type IndexedTransaction struct {
+	BlockNumber uint64       `json:"block_number"`
+	BlockHash   string       `json:"block_hash"`
+	Position    int          `json:"position"`
+	Transaction *Transaction `json:"transaction"`
+	block       *Block
+}
+
+// ChainIndex maintains lookups over the blocks of the chain so balances, nonces and transactions
+// can be queried without scanning every block. Blocks are connected and disconnected at the tip
+// as the chain grows or reorganizes. The index has its own lock so it can be read while the
+// blockchain is being updated.
+type ChainIndex struct {
+	mutex        sync.RWMutex
+	height       uint64
+	blocks       map[string]uint64
+	transactions map[string]*IndexedTransaction
+	addresses    map[string][]*IndexedTransaction
+	nonRewarded  []*IndexedTransaction
+	state        *ChainState
+	matured      map[uint64][]ImmatureReward
+}
+
+// NewChainIndex creates an index by connecting every block of the given chain in order.
+// When base is not nil the index starts from the snapshot's state and only the blocks after
+// its height are connected. Earlier blocks only have their hashes indexed, so their transactions cannot be looked up.
+func NewChainIndex(base *StateSnapshot, blocks []*Block) *ChainIndex {
+	ci := new(ChainIndex)
+	ci.blocks = map[string]uint64{}
+	ci.transactions = map[string]*IndexedTransaction{}
+	ci.addresses = map[string][]*IndexedTransaction{}
+	ci.nonRewarded = []*IndexedTransaction{}
+	ci.state = NewChainState()
+	ci.matured = map[uint64][]ImmatureReward{}
+
+	if base != nil {
+		ci.state = base.State.Copy()
+		ci.height = base.Height + 1
+		for _, block := range blocks[:base.Height+1] {
+			ci.blocks[block.Hash()] = block.BlockNumber
+		}
+		blocks = blocks[base.Height+1:]
+	}
+
+	for _, block := range blocks {
+		ci.connectBlock(block)
+	}
+
+	return ci
+}
+
+// connectBlock adds a block on top of the indexed tip. The rewards maturing at the block's height
+// are remembered so they can be made immature again if the block is disconnected.
+func (ci *ChainIndex) connectBlock(b *Block) {
+	ci.mutex.Lock()
+	defer ci.mutex.Unlock()
+
+	ci.matured[b.BlockNumber] = ci.state.MatureRewards(b.BlockNumber)
+	ci.state.ApplyBlock(b)
+
+	blockHash := b.Hash()
+	ci.blocks[blockHash] = b.BlockNumber
+	for i, txn := range b.Transactions {
+		entry := &IndexedTransaction{
+			BlockNumber: b.BlockNumber,
+			BlockHash:   blockHash,
+			Position:    i,
+			Transaction: txn,
+			block:       b,
+		}
+
+		ci.transactions[txn.TransactionHash] = entry
+		ci.addresses[txn.From] = append(ci.addresses[txn.From], entry)
+		if txn.To != txn.From {
+			ci.addresses[txn.To] = append(ci.addresses[txn.To], entry)
+		}
+		if txn.From != constants.BLOCKCHAIN_ADDRESS {
+			ci.nonRewarded = append(ci.nonRewarded, entry)
+		}
+	}
+
+	ci.height = b.BlockNumber + 1
+}
+
+// disconnectBlock removes the indexed tip block, reverting its transactions and making the
+// rewards that matured at its height immature again
+func (ci *ChainIndex) disconnectBlock(b *Block) {
+	ci.mutex.Lock()
+	defer ci.mutex.Unlock()
+
+	for i := len(b.Transactions) - 1; i >= 0; i-- {
+		txn := b.Transactions[i]
+		if txn.Status == constants.SUCCESS {
+			if txn.From == constants.BLOCKCHAIN_ADDRESS && b.BlockNumber > 0 {
+				ci.state.removeReward(txn, b.BlockNumber)
+			} else {
+				ci.state.revertTransaction(txn)
+			}
+		}
+
+		delete(ci.transactions, txn.TransactionHash)
+		ci.popAddress(txn.From)
+		if txn.To != txn.From {
+			ci.popAddress(txn.To)
+		}
+		if txn.From != constants.BLOCKCHAIN_ADDRESS {
+			ci.nonRewarded = ci.nonRewarded[:len(ci.nonRewarded)-1]
+		}
+	}
+
+	matured := ci.matured[b.BlockNumber]
+	for _, reward := range matured {
+		ci.state.Balances[reward.Address] -= reward.Value
+	}
+	ci.state.Immature = append(matured, ci.state.Immature...)
+	delete(ci.matured, b.BlockNumber)
+	delete(ci.blocks, b.Hash())
+
+	ci.height = b.BlockNumber
+}
+
+// popAddress removes the newest transaction from an address's history
+func (ci *ChainIndex) popAddress(address string) {
+	history := ci.addresses[address]
+	if len(history) <= 1 {
+		delete(ci.addresses, address)
+		return
+	}
+
+	ci.addresses[address] = history[:len(history)-1]
+}
+
+// BlockNumber returns the number of the block with the given hash and whether it is part of the chain
+func (ci *ChainIndex) BlockNumber(blockHash string) (uint64, bool) {
+	ci.mutex.RLock()
+	defer ci.mutex.RUnlock()
+
+	blockNumber, ok := ci.blocks[blockHash]
+
+	return blockNumber, ok
+}
+
+// Transaction returns the indexed transaction with the given hash and whether it was found
+func (ci *ChainIndex) Transaction(txnHash string) (*IndexedTransaction, bool) {
+	ci.mutex.RLock()
+	defer ci.mutex.RUnlock()
+
+	entry, ok := ci.transactions[txnHash]
+
+	return entry, ok
+}
+
+// AddressHistory returns up to limit transactions sent or received by an address, newest first,
+// skipping the offset newest ones, along with the total number of transactions of the address
+func (ci *ChainIndex) AddressHistory(address string, offset int, limit int) ([]*IndexedTransaction, int) {
+	ci.mutex.RLock()
+	defer ci.mutex.RUnlock()
+
+	history := ci.addresses[address]
+	page := []*IndexedTransaction{}
+	for i := len(history) - 1 - offset; i >= 0 && len(page) < limit; i-- {
+		page = append(page, history[i])
+	}
+
+	return page, len(history)
+}
+
+// NonRewarded returns every indexed transaction that is not a mining reward, newest first
+func (ci *ChainIndex) NonRewarded() []*IndexedTransaction {
+	ci.mutex.RLock()
+	defer ci.mutex.RUnlock()
+
+	txns := []*IndexedTransaction{}
+	for i := len(ci.nonRewarded) - 1; i >= 0; i-- {
+		txns = append(txns, ci.nonRewarded[i])
+	}
+
+	return txns
+}
+
+// Balance returns the balance of an address that can be spent by the next block,
+// including mining rewards that mature at the next height
+func (ci *ChainIndex) Balance(address string) uint64 {
+	ci.mutex.RLock()
+	defer ci.mutex.RUnlock()
+
+	balance := ci.state.Balance(address)
+	for _, reward := range ci.state.Immature {
+		if reward.Address == address && reward.BlockNumber+constants.COINBASE_MATURITY <= ci.height {
+			balance += reward.Value
+		}
+	}
+
+	return balance
+}
+
+// ImmatureBalance returns the total of an address's mining rewards that cannot be spent by the next block
+func (ci *ChainIndex) ImmatureBalance(address string) uint64 {
+	ci.mutex.RLock()
+	defer ci.mutex.RUnlock()
+
+	var balance uint64 = 0
+	for _, reward := range ci.state.Immature {
+		if reward.Address == address && reward.BlockNumber+constants.COINBASE_MATURITY > ci.height {
+			balance += reward.Value
+		}
+	}
+
+	return balance
+}
+
+// State returns a copy of the state at the indexed tip, with the rewards that can be spent by the next block matured
+func (ci *ChainIndex) State() *ChainState {
+	ci.mutex.RLock()
+	defer ci.mutex.RUnlock()
+
+	state := ci.state.Copy()
+	state.MatureRewards(ci.height)
+
+	return state
+}
+
+// NextNonce returns the nonce the next transaction sent by an address must carry according to the chain
+func (ci *ChainIndex) NextNonce(address string) uint64 {
+	ci.mutex.RLock()
+	defer ci.mutex.RUnlock()
+
+	return ci.state.NextNonce(address)
+}
@@ -0,0 +1,97 @@
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/SunTzu71/suntzu_blockchain/constants"
+)
+
+// testIndexSummary holds what the chain index reports for the addresses of a test chain
+type testIndexSummary struct {
+	height      uint64
+	balances    [3]uint64
+	immature    uint64
+	nonces      [2]uint64
+	histories   [3]int
+	nonRewarded int
+}
+
+// testSummarize returns what the index reports for the sender, receiver and miner addresses
+func testSummarize(ci *ChainIndex, sender string, receiver string, miner string) testIndexSummary {
+	s := testIndexSummary{height: ci.height, immature: ci.ImmatureBalance(miner), nonRewarded: len(ci.NonRewarded())}
+	for i, address := range []string{sender, receiver, miner} {
+		s.balances[i] = ci.Balance(address)
+		_, s.histories[i] = ci.AddressHistory(address, 0, 0)
+	}
+	s.nonces = [2]uint64{ci.NextNonce(sender), ci.NextNonce(miner)}
+
+	return s
+}
+
+func TestChainIndexDisconnectRestoresState(t *testing.T) {
+	maturity := int(constants.COINBASE_MATURITY)
+	sender, miner := newTestKey(t), newTestKey(t)
+
+	// A transfer in block 1, then the reward of block 1 spent as soon as it matures
+	chain := testFundedBlockchain(sender.address, 1000).Blocks
+	chain = append(chain, testMineBlock(chain, []*Transaction{sender.transfer(t, "receiver", 100, 1, 0)}, miner.address))
+	chain = testExtendChain(chain, maturity, miner.address)
+	chain = append(chain, testMineBlock(chain, []*Transaction{miner.transfer(t, "receiver", 50, 0, 0)}, miner.address))
+
+	ci := NewChainIndex(nil, chain)
+	if balance := ci.Balance("receiver"); balance != 150 {
+		t.Fatalf("receiver balance = %d, want 150", balance)
+	}
+
+	for height := len(chain) - 1; height > 0; height-- {
+		ci.disconnectBlock(chain[height])
+
+		want := testSummarize(NewChainIndex(nil, chain[:height]), sender.address, "receiver", miner.address)
+		if got := testSummarize(ci, sender.address, "receiver", miner.address); got != want {
+			t.Errorf("after disconnecting block %d the index reports %+v, want %+v", height, got, want)
+		}
+		if _, ok := ci.BlockNumber(chain[height].Hash()); ok {
+			t.Errorf("disconnected block %d is still indexed", height)
+		}
+		for _, txn := range chain[height].Transactions {
+			if _, ok := ci.Transaction(txn.TransactionHash); ok {
+				t.Errorf("transaction %s of disconnected block %d is still indexed", txn.TransactionHash, height)
+			}
+		}
+	}
+}
+
+func TestAddressHistory(t *testing.T) {
+	bc := testBlockchain(5, "miner")
+
+	tests := []struct {
+		name        string
+		offset      int
+		limit       int
+		wantNumbers []uint64
+	}{
+		{"newest first", 0, 2, []uint64{5, 4}},
+		{"offset", 2, 2, []uint64{3, 2}},
+		{"last page", 4, 10, []uint64{1}},
+		{"past the end", 5, 10, []uint64{}},
+		{"zero limit", 0, 0, []uint64{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, total := bc.index.AddressHistory("miner", tt.offset, tt.limit)
+			if total != 5 {
+				t.Errorf("total = %d, want 5", total)
+			}
+
+			if len(page) != len(tt.wantNumbers) {
+				t.Fatalf("page holds %d transactions, want %d", len(page), len(tt.wantNumbers))
+			}
+			for i, entry := range page {
+				if entry.BlockNumber != tt.wantNumbers[i] {
+					t.Errorf("entry %d is from block %d, want %d", i, entry.BlockNumber, tt.wantNumbers[i])
+				}
+			}
+		})
+	}
+}
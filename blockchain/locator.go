@@ -0,0 +1,74 @@
+package blockchain
+
+import (
+	"errors"
+
+	"github.com/SunTzu71/suntzu_blockchain/constants"
+)
+
+// A block locator lists hashes of our chain from the tip back to genesis: the LOCATOR_DENSE_HASHES
+// newest blocks one by one, then with the distance between blocks doubling at every step. A peer
+// finds the first hash it knows, which is the highest block the two chains share as far as the
+// locator can tell, in a number of steps logarithmic in the chain length.
+
+// LocatorFork is a peer's reply to a block locator: the highest block of the locator it shares
+// with us and the hashes of its blocks after it
+type LocatorFork struct {
+	BlockNumber uint64   `json:"block_number"`
+	BlockHash   string   `json:"block_hash"`
+	Hashes      []string `json:"hashes"`
+}
+
+// BlockLocator: returns the block locator of our chain, starting at the tip and always ending at genesis
+func (bc *BlockchainCore) BlockLocator() []string {
+	bc.mutex.Lock()
+	defer bc.mutex.Unlock()
+
+	locator := []string{}
+	var step uint64 = 1
+	height := bc.Blocks[len(bc.Blocks)-1].BlockNumber
+	for {
+		locator = append(locator, bc.Blocks[height].Hash())
+		if height == 0 {
+			break
+		}
+
+		if len(locator) >= constants.LOCATOR_DENSE_HASHES {
+			step *= 2
+		}
+		height -= min(height, step)
+	}
+
+	return locator
+}
+
+// FindFork: finds the highest block of a peer's locator that is part of our chain and returns it with
+// the hashes of up to count of our blocks after it
+// Returns an error if the locator is empty, too long or shares no block with our chain
+func (bc *BlockchainCore) FindFork(locator []string, count int) (*LocatorFork, error) {
+	if len(locator) == 0 || len(locator) > constants.MAX_LOCATOR_HASHES {
+		return nil, errors.New("invalid block locator length")
+	}
+
+	bc.mutex.Lock()
+	defer bc.mutex.Unlock()
+
+	for _, hash := range locator {
+		blockNumber, ok := bc.index.BlockNumber(hash)
+		if !ok {
+			continue
+		}
+
+		fork := new(LocatorFork)
+		fork.BlockNumber = blockNumber
+		fork.BlockHash = hash
+		fork.Hashes = []string{}
+		for _, block := range bc.Blocks[blockNumber+1 : min(blockNumber+1+uint64(count), uint64(len(bc.Blocks)))] {
+			fork.Hashes = append(fork.Hashes, block.Hash())
+		}
+
+		return fork, nil
+	}
+
+	return nil, errors.New("block locator shares no block with our chain")
+}
@@ -0,0 +1,100 @@
+package blockchain
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/SunTzu71/suntzu_blockchain/constants"
+)
+
+// testLocatorBlockchain returns a blockchain holding chain with its index, without a store
+func testLocatorBlockchain(chain []*Block) *BlockchainCore {
+	return &BlockchainCore{Blocks: chain, index: NewChainIndex(nil, chain)}
+}
+
+// testForkedChain returns the blocks of chain up to and including shared followed by blocks
+// with other timestamps up to the same length
+func testForkedChain(chain []*Block, shared int) []*Block {
+	fork := append([]*Block{}, chain[:shared+1]...)
+	for _, block := range testTimedChain(len(chain), 2, 1)[shared+1:] {
+		fork = append(fork, block)
+	}
+
+	return fork
+}
+
+func TestBlockLocator(t *testing.T) {
+	tests := []struct {
+		name        string
+		length      int
+		wantHeights []uint64
+	}{
+		{"genesis only", 1, []uint64{0}},
+		{"short chain lists every block", 6, []uint64{5, 4, 3, 2, 1, 0}},
+		{"spacing doubles after the dense hashes", 31, []uint64{30, 29, 28, 27, 26, 25, 24, 23, 22, 21, 19, 15, 7, 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chain := testTimedChain(tt.length, 1, 1)
+
+			want := []string{}
+			for _, height := range tt.wantHeights {
+				want = append(want, chain[height].Hash())
+			}
+
+			if got := testLocatorBlockchain(chain).BlockLocator(); !slices.Equal(got, want) {
+				t.Errorf("BlockLocator() holds %d hashes, want the blocks at %v", len(got), tt.wantHeights)
+			}
+		})
+	}
+}
+
+func TestFindFork(t *testing.T) {
+	chain := testTimedChain(31, 1, 1)
+	bc := testLocatorBlockchain(chain)
+
+	tests := []struct {
+		name       string
+		locator    []string
+		count      int
+		wantErr    bool
+		wantNumber uint64
+		wantHashes int
+	}{
+		{"our own tip", bc.BlockLocator(), 5, false, 30, 0},
+		{"fork after block 20", testLocatorBlockchain(testForkedChain(chain, 20)).BlockLocator(), 5, false, 19, 5},
+		{"fewer blocks than count", testLocatorBlockchain(testForkedChain(chain, 27)).BlockLocator(), 5, false, 27, 3},
+		{"shared genesis only", testLocatorBlockchain(testForkedChain(chain, 0)).BlockLocator(), 2, false, 0, 2},
+		{"empty locator", []string{}, 5, true, 0, 0},
+		{"too many hashes", make([]string, constants.MAX_LOCATOR_HASHES+1), 5, true, 0, 0},
+		{"no shared block", []string{"0x1", "0x2"}, 5, true, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fork, err := bc.FindFork(tt.locator, tt.count)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("FindFork() error = nil, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FindFork() error = %v", err)
+			}
+
+			if fork.BlockNumber != tt.wantNumber || fork.BlockHash != chain[tt.wantNumber].Hash() {
+				t.Errorf("fork at block %d %s, want block %d", fork.BlockNumber, fork.BlockHash, tt.wantNumber)
+			}
+			if len(fork.Hashes) != tt.wantHashes {
+				t.Fatalf("fork holds %d hashes, want %d", len(fork.Hashes), tt.wantHashes)
+			}
+			for i, hash := range fork.Hashes {
+				if hash != chain[tt.wantNumber+1+uint64(i)].Hash() {
+					t.Errorf("hash %d = %s, want block %d", i, hash, tt.wantNumber+1+uint64(i))
+				}
+			}
+		})
+	}
+}
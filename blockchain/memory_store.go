@@ -0,0 +1,246 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+)
+
+// MemoryStore is a Store that keeps the blockchain in memory, for running several nodes in one
+// process or embedding the chain without touching the filesystem. Values are kept as JSON so
+// blocks handed to the store are never shared with the BlockchainCore using it.
+type MemoryStore struct {
+	mutex   sync.Mutex
+	blocks  [][]byte
+	pool    [][]byte
+	peers   []byte
+	address string
+	base    []byte
+	bans    []byte
+}
+
+// NewMemoryStore: creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return new(MemoryStore)
+}
+
+// Exists: reports whether a blockchain has been saved to the store
+func (ms *MemoryStore) Exists() bool {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	return len(ms.blocks) > 0
+}
+
+// Load: decodes the stored blocks, transaction pool, peers and address
+// Returns an error if the store is empty
+func (ms *MemoryStore) Load() (*BlockchainCore, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	if len(ms.blocks) == 0 {
+		return nil, errors.New("memory store is empty")
+	}
+
+	bs := new(BlockchainCore)
+	bs.Blocks = []*Block{}
+	for _, data := range ms.blocks {
+		block := new(Block)
+		err := json.Unmarshal(data, block)
+		if err != nil {
+			return nil, err
+		}
+		bs.Blocks = append(bs.Blocks, block)
+	}
+
+	bs.TransactionPool = []*Transaction{}
+	for _, data := range ms.pool {
+		txn := new(Transaction)
+		err := json.Unmarshal(data, txn)
+		if err != nil {
+			return nil, err
+		}
+		bs.TransactionPool = append(bs.TransactionPool, txn)
+	}
+
+	err := json.Unmarshal(ms.peers, &bs.Peers)
+	if err != nil {
+		return nil, err
+	}
+
+	bs.Address = ms.address
+
+	if ms.base != nil {
+		err = json.Unmarshal(ms.base, &bs.BaseSnapshot)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return bs, nil
+}
+
+// SaveBlockchain: replaces the stored blockchain with the given blockchain core state
+func (ms *MemoryStore) SaveBlockchain(bc *BlockchainCore) error {
+	blocks, err := encodeBlocks(bc.Blocks)
+	if err != nil {
+		return err
+	}
+
+	pool, err := encodePool(bc.TransactionPool)
+	if err != nil {
+		return err
+	}
+
+	peers, err := json.Marshal(bc.Peers)
+	if err != nil {
+		return err
+	}
+
+	var base []byte
+	if bc.BaseSnapshot != nil {
+		base, err = json.Marshal(bc.BaseSnapshot)
+		if err != nil {
+			return err
+		}
+	}
+
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	ms.blocks = blocks
+	ms.pool = pool
+	ms.peers = peers
+	ms.address = bc.Address
+	ms.base = base
+
+	return nil
+}
+
+// ConnectBlock: appends a block to the stored chain and replaces the transaction pool
+func (ms *MemoryStore) ConnectBlock(b *Block, pool []*Transaction) error {
+	return ms.Reorganize(b.BlockNumber, b.BlockNumber, []*Block{b}, pool)
+}
+
+// Reorganize: truncates the stored chain at forkIndex, appends the connected blocks and
+// replaces the transaction pool
+// Returns an error if the stored chain is shorter than oldLength
+func (ms *MemoryStore) Reorganize(forkIndex uint64, oldLength uint64, connected []*Block, pool []*Transaction) error {
+	blocks, err := encodeBlocks(connected)
+	if err != nil {
+		return err
+	}
+
+	poolData, err := encodePool(pool)
+	if err != nil {
+		return err
+	}
+
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	if uint64(len(ms.blocks)) != oldLength {
+		return errors.New("memory store chain length does not match")
+	}
+
+	ms.blocks = append(ms.blocks[:forkIndex:forkIndex], blocks...)
+	ms.pool = poolData
+
+	return nil
+}
+
+// AddPoolTransaction: appends a transaction to the stored transaction pool
+func (ms *MemoryStore) AddPoolTransaction(txn *Transaction) error {
+	data, err := json.Marshal(txn)
+	if err != nil {
+		return err
+	}
+
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	ms.pool = append(ms.pool, data)
+
+	return nil
+}
+
+// SavePeers: replaces the stored peers map
+func (ms *MemoryStore) SavePeers(peers map[string]bool) error {
+	data, err := json.Marshal(peers)
+	if err != nil {
+		return err
+	}
+
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	ms.peers = data
+
+	return nil
+}
+
+// LoadBans: decodes the stored banned peers, empty if none were saved
+func (ms *MemoryStore) LoadBans() ([]PeerBan, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	bans := []PeerBan{}
+	if ms.bans == nil {
+		return bans, nil
+	}
+
+	err := json.Unmarshal(ms.bans, &bans)
+	if err != nil {
+		return nil, err
+	}
+
+	return bans, nil
+}
+
+// SaveBans: replaces the stored banned peers
+func (ms *MemoryStore) SaveBans(bans []PeerBan) error {
+	data, err := json.Marshal(bans)
+	if err != nil {
+		return err
+	}
+
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	ms.bans = data
+
+	return nil
+}
+
+// Close: does nothing, the memory store holds no external resources
+func (ms *MemoryStore) Close() error {
+	return nil
+}
+
+// encodeBlocks: marshals every block to JSON
+func encodeBlocks(blocks []*Block) ([][]byte, error) {
+	encoded := [][]byte{}
+	for _, block := range blocks {
+		data, err := json.Marshal(block)
+		if err != nil {
+			return nil, err
+		}
+		encoded = append(encoded, data)
+	}
+
+	return encoded, nil
+}
+
+// encodePool: marshals every pool transaction to JSON
+func encodePool(pool []*Transaction) ([][]byte, error) {
+	encoded := [][]byte{}
+	for _, txn := range pool {
+		data, err := json.Marshal(txn)
+		if err != nil {
+			return nil, err
+		}
+		encoded = append(encoded, data)
+	}
+
+	return encoded, nil
+}
@@ -0,0 +1,111 @@
+package blockchain
+
+import (
+	"testing"
+)
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+	if store.Exists() {
+		t.Fatal("Exists() = true for an empty store")
+	}
+	if _, err := store.Load(); err == nil {
+		t.Fatal("Load() error = nil for an empty store")
+	}
+
+	bc := testBlockchain(2, "miner")
+	bc.Address = "node"
+	if err := store.SaveBlockchain(bc); err != nil {
+		t.Fatal(err)
+	}
+
+	chain := testExtendChain(bc.Blocks, 1, "miner")
+	pool := testTransactions(2)
+	if err := store.ConnectBlock(chain[3], pool[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AddPoolTransaction(pool[1]); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	testSameBlocks(t, loaded.Blocks, chain)
+	if len(loaded.TransactionPool) != 2 || loaded.TransactionPool[1].TransactionHash != pool[1].TransactionHash {
+		t.Errorf("loaded pool %v, want %v", loaded.TransactionPool, pool)
+	}
+	if loaded.Address != "node" {
+		t.Errorf("loaded address %q, want %q", loaded.Address, "node")
+	}
+
+	// The store keeps its own copies, so changing a loaded block does not change the store
+	loaded.Blocks[3].Nonce++
+	reloaded, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	testSameBlocks(t, reloaded.Blocks, chain)
+}
+
+func TestMemoryStoreReorganize(t *testing.T) {
+	tests := []struct {
+		name       string
+		forkIndex  uint64
+		oldLength  uint64
+		connected  int
+		wantErr    bool
+		wantLength int
+	}{
+		{"replace the tip", 3, 4, 2, false, 5},
+		{"append to the tip", 4, 4, 1, false, 5},
+		{"disconnect without replacement", 2, 4, 0, false, 2},
+		{"stale chain length", 3, 3, 2, true, 4},
+		{"chain longer than stored", 3, 5, 2, true, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemoryStore()
+			bc := testBlockchain(3, "miner")
+			if err := store.SaveBlockchain(bc); err != nil {
+				t.Fatal(err)
+			}
+
+			fork := testExtendChain(bc.Blocks[:tt.forkIndex], tt.connected, "other")
+			err := store.Reorganize(tt.forkIndex, tt.oldLength, fork[tt.forkIndex:], []*Transaction{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Reorganize() error = %v, want error %v", err, tt.wantErr)
+			}
+
+			loaded, err := store.Load()
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			want := fork
+			if tt.wantErr {
+				want = bc.Blocks
+			}
+			if len(loaded.Blocks) != tt.wantLength {
+				t.Fatalf("loaded %d blocks, want %d", len(loaded.Blocks), tt.wantLength)
+			}
+			testSameBlocks(t, loaded.Blocks, want)
+		})
+	}
+}
+
+func TestNewBlockchainReloadsFromStore(t *testing.T) {
+	store := NewMemoryStore()
+	bc := testBlockchain(2, "miner")
+	if err := store.SaveBlockchain(bc); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded := NewBlockchain(*bc.Blocks[0], "", store)
+
+	testSameBlocks(t, reloaded.Blocks, bc.Blocks)
+	if balance := reloaded.index.ImmatureBalance("miner"); balance != bc.index.ImmatureBalance("miner") {
+		t.Errorf("reloaded immature balance = %d, want %d", balance, bc.index.ImmatureBalance("miner"))
+	}
+}
@@ -0,0 +1,145 @@
+package blockchain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"github.com/SunTzu71/suntzu_blockchain/constants"
+)
+
+// MerkleProofStep is one level of a Merkle inclusion proof: the sibling hash to combine with
+// and whether that sibling sits on the left side of the pair
+type MerkleProofStep struct {
+	Hash string `json:"hash"`
+	Left bool   `json:"left"`
+}
+
+// MerkleProof proves that a transaction is included in a block by linking its leaf hash
+// to the Merkle root stored in the block header
+type MerkleProof struct {
+	TransactionHash string            `json:"transaction_hash"`
+	LeafHash        string            `json:"leaf_hash"`
+	BlockNumber     uint64            `json:"block_number"`
+	BlockHash       string            `json:"block_hash"`
+	MerkleRoot      string            `json:"merkle_root"`
+	Index           int               `json:"index"`
+	Steps           []MerkleProofStep `json:"steps"`
+}
+
+// merkleLeaf: hashes the canonical encoding of a transaction, including its status and signature,
+// into a leaf of the Merkle tree
+func merkleLeaf(txn *Transaction) []byte {
+	sum := sha256.Sum256(txn.Encode())
+	return sum[:]
+}
+
+// merkleParent: hashes two child nodes of the Merkle tree into their parent node
+func merkleParent(left []byte, right []byte) []byte {
+	sum := sha256.Sum256(append(append([]byte{}, left...), right...))
+	return sum[:]
+}
+
+// merkleLevels: builds every level of the Merkle tree from the leaves up to the root.
+// When a level has an odd number of nodes the last node is paired with itself, so a list
+// ending in a duplicated transaction has the same root: blocks with duplicate transactions
+// must be rejected before their Merkle root is checked.
+func merkleLevels(txns []*Transaction) [][][]byte {
+	level := [][]byte{}
+	for _, txn := range txns {
+		level = append(level, merkleLeaf(txn))
+	}
+
+	levels := [][][]byte{level}
+	for len(level) > 1 {
+		if len(level)%2 == 1 {
+			level = append(level, level[len(level)-1])
+			levels[len(levels)-1] = level
+		}
+
+		nextLevel := [][]byte{}
+		for i := 0; i < len(level); i += 2 {
+			nextLevel = append(nextLevel, merkleParent(level[i], level[i+1]))
+		}
+
+		level = nextLevel
+		levels = append(levels, level)
+	}
+
+	return levels
+}
+
+// ComputeMerkleRoot: computes the Merkle root of a list of transactions as a hex string
+// with the hex prefix. An empty list has a root of all zeros.
+func ComputeMerkleRoot(txns []*Transaction) string {
+	if len(txns) == 0 {
+		return constants.HEX_PREFIX + hex.EncodeToString(make([]byte, sha256.Size))
+	}
+
+	levels := merkleLevels(txns)
+	return constants.HEX_PREFIX + hex.EncodeToString(levels[len(levels)-1][0])
+}
+
+// BuildMerkleProof: builds the list of sibling hashes linking the transaction at index
+// to the Merkle root of the given transactions
+func BuildMerkleProof(txns []*Transaction, index int) []MerkleProofStep {
+	steps := []MerkleProofStep{}
+	levels := merkleLevels(txns)
+
+	for _, level := range levels[:len(levels)-1] {
+		if index%2 == 0 {
+			steps = append(steps, MerkleProofStep{Hash: constants.HEX_PREFIX + hex.EncodeToString(level[index+1]), Left: false})
+		} else {
+			steps = append(steps, MerkleProofStep{Hash: constants.HEX_PREFIX + hex.EncodeToString(level[index-1]), Left: true})
+		}
+		index /= 2
+	}
+
+	return steps
+}
+
+// VerifyMerkleProof: verifies that a transaction is included under the given Merkle root
+// by hashing its leaf together with each sibling of the proof in turn.
+// Returns true if the resulting root matches, false otherwise.
+func VerifyMerkleProof(txn *Transaction, merkleRoot string, steps []MerkleProofStep) bool {
+	node := merkleLeaf(txn)
+	for _, step := range steps {
+		sibling, err := hex.DecodeString(strings.TrimPrefix(step.Hash, constants.HEX_PREFIX))
+		if err != nil {
+			return false
+		}
+
+		if step.Left {
+			node = merkleParent(sibling, node)
+		} else {
+			node = merkleParent(node, sibling)
+		}
+	}
+
+	return constants.HEX_PREFIX+hex.EncodeToString(node) == merkleRoot
+}
+
+// CalculateMerkleRoot: computes the Merkle root over the encodings of the block's transactions
+func (b Block) CalculateMerkleRoot() string {
+	return ComputeMerkleRoot(b.Transactions)
+}
+
+// GetMerkleProof: looks up the block containing the transaction with the given hash in the chain index
+// and builds a Merkle inclusion proof for it. Returns an error if the transaction is not in any block.
+func (bc *BlockchainCore) GetMerkleProof(txnHash string) (*MerkleProof, error) {
+	entry, err := bc.GetTransaction(txnHash)
+	if err != nil {
+		return nil, err
+	}
+
+	proof := new(MerkleProof)
+	proof.TransactionHash = txnHash
+	proof.LeafHash = constants.HEX_PREFIX + hex.EncodeToString(merkleLeaf(entry.block.Transactions[entry.Position]))
+	proof.BlockNumber = entry.BlockNumber
+	proof.BlockHash = entry.BlockHash
+	proof.MerkleRoot = entry.block.MerkleRoot
+	proof.Index = entry.Position
+	proof.Steps = BuildMerkleProof(entry.block.Transactions, entry.Position)
+
+	return proof, nil
+}
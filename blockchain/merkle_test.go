@@ -0,0 +1,114 @@
+package blockchain
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/SunTzu71/suntzu_blockchain/constants"
+)
+
+// testTransactions returns count distinct unsigned transactions with a fixed timestamp
+func testTransactions(count int) []*Transaction {
+	txns := []*Transaction{}
+	for i := 0; i < count; i++ {
+		txn := NewTransaction("sender", "receiver", uint64(i+1), 0, uint64(i), []byte{})
+		txn.Timestamp = 1
+		txn.TransactionHash = txn.Hash()
+		txns = append(txns, txn)
+	}
+
+	return txns
+}
+
+func TestComputeMerkleRoot(t *testing.T) {
+	txns := testTransactions(3)
+	failed := *txns[2]
+	failed.Status = constants.FAILED
+
+	tests := []struct {
+		name      string
+		a, b      []*Transaction
+		wantEqual bool
+	}{
+		{"same transactions", txns, testTransactions(3), true},
+		{"odd level pairs the last node with itself", txns, append(testTransactions(3), txns[2]), true},
+		{"order matters", txns, []*Transaction{txns[1], txns[0], txns[2]}, false},
+		{"status is committed", txns, []*Transaction{txns[0], txns[1], &failed}, false},
+		{"extra transaction", txns, testTransactions(4), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := ComputeMerkleRoot(tt.a), ComputeMerkleRoot(tt.b)
+			if (a == b) != tt.wantEqual {
+				t.Errorf("roots %s and %s, want equal = %v", a, b, tt.wantEqual)
+			}
+		})
+	}
+}
+
+func TestComputeMerkleRootEmpty(t *testing.T) {
+	want := constants.HEX_PREFIX + strings.Repeat("0", 64)
+	if got := ComputeMerkleRoot([]*Transaction{}); got != want {
+		t.Errorf("ComputeMerkleRoot() = %s, want %s", got, want)
+	}
+}
+
+func TestVerifyMerkleProof(t *testing.T) {
+	for count := 1; count <= 7; count++ {
+		txns := testTransactions(count)
+		root := ComputeMerkleRoot(txns)
+
+		for index, txn := range txns {
+			if !VerifyMerkleProof(txn, root, BuildMerkleProof(txns, index)) {
+				t.Errorf("proof for transaction %d of %d does not verify", index, count)
+			}
+		}
+	}
+}
+
+func TestVerifyMerkleProofRejectsTampering(t *testing.T) {
+	txns := testTransactions(5)
+	root := ComputeMerkleRoot(txns)
+
+	tests := []struct {
+		name   string
+		tamper func(txn *Transaction, root string, steps []MerkleProofStep) (*Transaction, string, []MerkleProofStep)
+	}{
+		{"other transaction", func(txn *Transaction, root string, steps []MerkleProofStep) (*Transaction, string, []MerkleProofStep) {
+			return txns[3], root, steps
+		}},
+		{"changed value", func(txn *Transaction, root string, steps []MerkleProofStep) (*Transaction, string, []MerkleProofStep) {
+			changed := *txn
+			changed.Value++
+			return &changed, root, steps
+		}},
+		{"other root", func(txn *Transaction, root string, steps []MerkleProofStep) (*Transaction, string, []MerkleProofStep) {
+			return txn, ComputeMerkleRoot(txns[:4]), steps
+		}},
+		{"changed sibling", func(txn *Transaction, root string, steps []MerkleProofStep) (*Transaction, string, []MerkleProofStep) {
+			steps[1].Hash = steps[0].Hash
+			return txn, root, steps
+		}},
+		{"swapped side", func(txn *Transaction, root string, steps []MerkleProofStep) (*Transaction, string, []MerkleProofStep) {
+			steps[0].Left = !steps[0].Left
+			return txn, root, steps
+		}},
+		{"missing step", func(txn *Transaction, root string, steps []MerkleProofStep) (*Transaction, string, []MerkleProofStep) {
+			return txn, root, steps[:len(steps)-1]
+		}},
+		{"sibling not hex", func(txn *Transaction, root string, steps []MerkleProofStep) (*Transaction, string, []MerkleProofStep) {
+			steps[0].Hash = "0xzz"
+			return txn, root, steps
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			txn, root, steps := tt.tamper(txns[2], root, BuildMerkleProof(txns, 2))
+			if VerifyMerkleProof(txn, root, steps) {
+				t.Error("VerifyMerkleProof() = true, want false")
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package blockchain
+
+import (
+	"github.com/SunTzu71/suntzu_blockchain/constants"
+)
+
+// scheduledReward: returns the reward the halving schedule pays at a block height, before the supply cap.
+// The reward starts at MINING_REWARD and halves every HALVING_INTERVAL blocks, never dropping below TAIL_EMISSION.
+func scheduledReward(height uint64) uint64 {
+	if height == 0 {
+		return 0
+	}
+
+	era := (height - 1) / constants.HALVING_INTERVAL
+	var reward uint64 = 0
+	if era < 64 {
+		reward = constants.MINING_REWARD >> era
+	}
+
+	return max(reward, constants.TAIL_EMISSION)
+}
+
+// scheduledSupply: returns the total paid by the halving schedule from block 1 up to and including height,
+// before the supply cap. Whole halving eras are summed at once so this does not depend on the chain length.
+func scheduledSupply(height uint64) uint64 {
+	var total uint64 = 0
+	var start uint64 = 1
+	for start <= height {
+		reward := scheduledReward(start)
+		if reward == constants.TAIL_EMISSION {
+			// The reward stays constant from here on
+			return total + (height-start+1)*reward
+		}
+
+		end := min(start-1+constants.HALVING_INTERVAL, height)
+		total += (end - start + 1) * reward
+		start = end + 1
+	}
+
+	return total
+}
+
+// GenesisSupply returns the amount allocated to addresses by the genesis block
+func GenesisSupply(genesisBlock *Block) uint64 {
+	var supply uint64 = 0
+	for _, txn := range genesisBlock.Transactions {
+		supply += txn.Value
+	}
+
+	return supply
+}
+
+// MinedSupply returns the total of all block rewards from block 1 up to and including height.
+// Mining stops adding coins once the genesis allocations plus mined rewards reach MAX_SUPPLY.
+func MinedSupply(height uint64, genesisSupply uint64) uint64 {
+	if genesisSupply >= constants.MAX_SUPPLY {
+		return 0
+	}
+
+	return min(scheduledSupply(height), constants.MAX_SUPPLY-genesisSupply)
+}
+
+// BlockReward returns the newly created coins a miner may claim for the block at height,
+// following the halving schedule and capped so the total supply never exceeds MAX_SUPPLY.
+// Transaction fees are paid on top of this amount.
+func BlockReward(height uint64, genesisSupply uint64) uint64 {
+	if height == 0 {
+		return 0
+	}
+
+	return MinedSupply(height, genesisSupply) - MinedSupply(height-1, genesisSupply)
+}
+
+// CirculatingSupply returns the total amount of coins in existence at our tip:
+// the genesis allocations plus every block reward mined so far
+func (bc *BlockchainCore) CirculatingSupply() uint64 {
+	blocks := bc.GetBlocks()
+	genesisSupply := GenesisSupply(blocks[0])
+	tip := blocks[len(blocks)-1].BlockNumber
+
+	return genesisSupply + MinedSupply(tip, genesisSupply)
+}
@@ -0,0 +1,81 @@
+package blockchain
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/SunTzu71/suntzu_blockchain/constants"
+)
+
+func TestBlockReward(t *testing.T) {
+	const interval = constants.HALVING_INTERVAL
+	nearCap := uint64(constants.MAX_SUPPLY - constants.MINING_REWARD - constants.MINING_REWARD/2)
+
+	tests := []struct {
+		name          string
+		height        uint64
+		genesisSupply uint64
+		want          uint64
+	}{
+		{"genesis pays nothing", 0, 0, 0},
+		{"first block", 1, 0, constants.MINING_REWARD},
+		{"last block of the first era", interval, 0, constants.MINING_REWARD},
+		{"first halving", interval + 1, 0, constants.MINING_REWARD / 2},
+		{"second halving", 2*interval + 1, 0, constants.MINING_REWARD / 4},
+		{"reward halved away", 64*interval + 1, 0, 0},
+		{"below the cap", 1, nearCap, constants.MINING_REWARD},
+		{"reaching the cap", 2, nearCap, constants.MINING_REWARD / 2},
+		{"cap reached", 3, nearCap, 0},
+		{"partial reward at the cap", 1, constants.MAX_SUPPLY - 1, 1},
+		{"genesis holds the whole supply", 1, constants.MAX_SUPPLY, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := BlockReward(tt.height, tt.genesisSupply); got != tt.want {
+				t.Errorf("BlockReward(%d, %d) = %d, want %d", tt.height, tt.genesisSupply, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMinedSupply(t *testing.T) {
+	const interval = constants.HALVING_INTERVAL
+
+	tests := []struct {
+		name          string
+		height        uint64
+		genesisSupply uint64
+		want          uint64
+	}{
+		{"genesis", 0, 0, 0},
+		{"first era", interval, 0, interval * constants.MINING_REWARD},
+		{"into the second era", interval + 2, 0, interval*constants.MINING_REWARD + constants.MINING_REWARD},
+		{"never above the cap", math.MaxUint64, constants.MAX_SUPPLY / 2, constants.MAX_SUPPLY / 2},
+		{"genesis holds the whole supply", interval, constants.MAX_SUPPLY, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MinedSupply(tt.height, tt.genesisSupply); got != tt.want {
+				t.Errorf("MinedSupply(%d, %d) = %d, want %d", tt.height, tt.genesisSupply, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateChainRejectsRewardAboveTheCap(t *testing.T) {
+	bc := testFundedBlockchain("alice", constants.MAX_SUPPLY-1)
+
+	block := testMineBlock(bc.Blocks, nil, "miner")
+	reward := block.Transactions[0]
+	reward.Value = constants.MINING_REWARD
+	reward.TransactionHash = reward.Hash()
+	testRemine(block)
+
+	var validationErr *ValidationError
+	if err := bc.ValidateChain([]*Block{block}); !errors.As(err, &validationErr) {
+		t.Fatalf("ValidateChain() = %v, want a *ValidationError", err)
+	}
+}
@@ -0,0 +1,103 @@
+package blockchain
+
+import (
+	"sync"
+	"time"
+
+	"github.com/SunTzu71/suntzu_blockchain/constants"
+)
+
+// orphanBlock is a block received from a peer before its parent
+type orphanBlock struct {
+	block    *Block
+	peer     string
+	received int64
+}
+
+// orphanPool holds blocks whose parent we do not have yet, keyed by the hash of the missing parent.
+// It holds at most MAX_ORPHAN_BLOCKS blocks, evicting the oldest first, and forgets blocks held
+// for longer than ORPHAN_EXPIRY seconds.
+type orphanPool struct {
+	mutex    sync.Mutex
+	byParent map[string][]*orphanBlock
+	hashes   map[string]bool
+	order    []*orphanBlock
+}
+
+// newOrphanPool creates an empty orphan pool
+func newOrphanPool() *orphanPool {
+	return &orphanPool{byParent: map[string][]*orphanBlock{}, hashes: map[string]bool{}, order: []*orphanBlock{}}
+}
+
+// add holds a block received from peer until its parent arrives and reports whether it was not held already
+func (op *orphanPool) add(b *Block, peer string) bool {
+	op.mutex.Lock()
+	defer op.mutex.Unlock()
+
+	op.expire()
+
+	hash := b.Hash()
+	if op.hashes[hash] {
+		return false
+	}
+
+	if len(op.order) >= constants.MAX_ORPHAN_BLOCKS {
+		op.remove(op.order[0])
+	}
+
+	orphan := &orphanBlock{block: b, peer: peer, received: time.Now().Unix()}
+	op.byParent[b.PrevHash] = append(op.byParent[b.PrevHash], orphan)
+	op.hashes[hash] = true
+	op.order = append(op.order, orphan)
+
+	return true
+}
+
+// take removes and returns the blocks waiting for the parent with the given hash
+func (op *orphanPool) take(parentHash string) []*orphanBlock {
+	op.mutex.Lock()
+	defer op.mutex.Unlock()
+
+	op.expire()
+
+	children := op.byParent[parentHash]
+	for _, orphan := range children {
+		op.remove(orphan)
+	}
+
+	return children
+}
+
+// expire removes the blocks held for longer than ORPHAN_EXPIRY seconds. Must be called with the mutex held.
+func (op *orphanPool) expire() {
+	cutoff := time.Now().Unix() - constants.ORPHAN_EXPIRY
+	for len(op.order) > 0 && op.order[0].received < cutoff {
+		op.remove(op.order[0])
+	}
+}
+
+// remove drops a held block from every lookup. Must be called with the mutex held.
+func (op *orphanPool) remove(orphan *orphanBlock) {
+	parentHash := orphan.block.PrevHash
+	siblings := op.byParent[parentHash]
+	for i, sibling := range siblings {
+		if sibling == orphan {
+			siblings = append(siblings[:i:i], siblings[i+1:]...)
+			break
+		}
+	}
+	if len(siblings) == 0 {
+		delete(op.byParent, parentHash)
+	} else {
+		op.byParent[parentHash] = siblings
+	}
+
+	for i, held := range op.order {
+		if held == orphan {
+			op.order = append(op.order[:i:i], op.order[i+1:]...)
+			break
+		}
+	}
+
+	delete(op.hashes, orphan.block.Hash())
+}
@@ -0,0 +1,147 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/SunTzu71/suntzu_blockchain/constants"
+)
+
+// testOrphanBlock returns a block with the given number and difficulty whose hash meets the difficulty if valid is true
+func testOrphanBlock(blockNumber uint64, difficulty int, valid bool) *Block {
+	b := NewBlock("0xparent", 0, blockNumber, difficulty)
+	for meetsDifficulty(b.Hash(), difficulty) != valid {
+		b.Nonce++
+	}
+
+	return b
+}
+
+func TestCheckOrphan(t *testing.T) {
+	tests := []struct {
+		name       string
+		tip        *Block
+		orphan     *Block
+		wantReject bool
+	}{
+		{"above tip", NewBlock("0x0", 0, 10, 2), testOrphanBlock(12, 2, true), false},
+		{"difficulty dropped by the allowed adjustments", NewBlock("0x0", 0, 10, 3), testOrphanBlock(25, 1, true), false},
+		{"difficulty dropped too far", NewBlock("0x0", 0, 10, 3), testOrphanBlock(12, 1, true), true},
+		{"hash misses difficulty", NewBlock("0x0", 0, 10, 2), testOrphanBlock(12, 2, false), true},
+		{"at tip height", NewBlock("0x0", 0, 10, 1), testOrphanBlock(10, 1, true), true},
+		{"below tip height", NewBlock("0x0", 0, 10, 1), testOrphanBlock(3, 1, true), true},
+		{"genesis height", NewBlock("0x0", 0, 0, 1), testOrphanBlock(0, 1, true), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkOrphan(tt.tip, tt.orphan)
+			if !tt.wantReject {
+				if err != nil {
+					t.Fatalf("checkOrphan() = %v, want nil", err)
+				}
+				return
+			}
+
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("checkOrphan() = %v, want a *ValidationError", err)
+			}
+		})
+	}
+}
+
+func TestOrphanPool(t *testing.T) {
+	op := newOrphanPool()
+	first, second := NewBlock("0xparent", 0, 5, 1), NewBlock("0xparent", 1, 5, 1)
+	other := NewBlock("0xother", 0, 5, 1)
+
+	steps := []struct {
+		name string
+		add  *Block
+		want bool
+	}{
+		{"first child", first, true},
+		{"sibling", second, true},
+		{"child of another parent", other, true},
+		{"already held", first, false},
+	}
+	for _, step := range steps {
+		if got := op.add(step.add, "peer"); got != step.want {
+			t.Errorf("%s: add() = %v, want %v", step.name, got, step.want)
+		}
+	}
+
+	children := op.take("0xparent")
+	if len(children) != 2 || children[0].block != first || children[1].block != second {
+		t.Fatalf("take() returned %d children, want both siblings in order", len(children))
+	}
+	if len(op.take("0xparent")) != 0 {
+		t.Error("taken children are still held")
+	}
+	if !op.add(first, "peer") {
+		t.Error("a taken child cannot be held again")
+	}
+	if len(op.take("0xother")) != 1 {
+		t.Error("child of another parent was not kept")
+	}
+}
+
+func TestOrphanPoolLimits(t *testing.T) {
+	tests := []struct {
+		name      string
+		count     int
+		age       int64
+		wantFirst bool
+		wantLast  bool
+	}{
+		{"within the limit", constants.MAX_ORPHAN_BLOCKS, 0, true, true},
+		{"oldest evicted above the limit", constants.MAX_ORPHAN_BLOCKS + 1, 0, false, true},
+		{"expired", 2, constants.ORPHAN_EXPIRY + 1, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			op := newOrphanPool()
+			for i := 0; i < tt.count; i++ {
+				op.add(NewBlock(fmt.Sprintf("0x%d", i), 0, uint64(i+2), 1), "peer")
+			}
+			for _, orphan := range op.order {
+				orphan.received -= tt.age
+			}
+
+			if got := len(op.take("0x0")) == 1; got != tt.wantFirst {
+				t.Errorf("first orphan held = %v, want %v", got, tt.wantFirst)
+			}
+			if got := len(op.take(fmt.Sprintf("0x%d", tt.count-1))) == 1; got != tt.wantLast {
+				t.Errorf("last orphan held = %v, want %v", got, tt.wantLast)
+			}
+		})
+	}
+}
+
+func TestConnectOrphans(t *testing.T) {
+	bc := testBlockchain(1, "miner")
+	chain := testExtendChain(bc.Blocks, 3, "miner")
+
+	// An invalid sibling waiting for the same parent is rejected without blocking the valid one
+	invalid := testMineBlock(chain[:3], nil, "other")
+	invalid.Transactions[0].Value++
+	invalid.Transactions[0].TransactionHash = invalid.Transactions[0].Hash()
+	testRemine(invalid)
+
+	for _, orphan := range []*Block{invalid, chain[3], chain[4]} {
+		bc.orphans.add(orphan, "peer")
+	}
+	if connected, err := bc.connectTip(chain[2]); !connected || err != nil {
+		t.Fatalf("connectTip() = %v, %v, want true, nil", connected, err)
+	}
+
+	bc.connectOrphans(chain[2].Hash())
+
+	testSameBlocks(t, bc.Blocks, chain)
+	if len(bc.orphans.order) != 0 {
+		t.Errorf("%d orphans are still held", len(bc.orphans.order))
+	}
+}
@@ -3,9 +3,11 @@ package blockchain
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"math/big"
 	"net/http"
 	"strings"
 	"time"
@@ -13,60 +15,301 @@ import (
 	"github.com/SunTzu71/suntzu_blockchain/constants"
 )
 
-// SyncBlockchain: retrieves and synchronizes the blockchain from a given address.
-// It makes an HTTP GET request to the provided address, reads the blockchain data,
-// and unmarshals it into a BlockchainCore struct. Returns a pointer to the
-// synchronized blockchain and any errors encountered.
-func SyncBlockchain(address string) (*BlockchainCore, error) {
-	log.Println("Syncing blockchain from:", address)
-	outURL := fmt.Sprintf("%s/", address)
-	resp, err := http.Get(outURL)
+// peerClient is the HTTP client used for peer requests, giving up on peers that take longer than PEER_REQUEST_TIMEOUT
+var peerClient = &http.Client{Timeout: constants.PEER_REQUEST_TIMEOUT * time.Second}
+
+// ErrBlocksPruned is returned when a peer started from a snapshot and does not store the transactions
+// of the requested blocks. The peer served nothing invalid, so it is not penalized.
+var ErrBlocksPruned = errors.New("blocks up to the peer's snapshot height are not stored")
+
+// sendPeerRequest: sends an HTTP request to a peer with our chain ID in the CHAIN_ID_HEADER header,
+// so peers on other networks can refuse it. Returns the response and any error encountered.
+func sendPeerRequest(method string, url string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set(constants.CHAIN_ID_HEADER, constants.CHAIN_ID)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	return peerClient.Do(req)
+}
+
+// SyncBlockchainFromSnapshot: bootstraps a blockchain from the state snapshot served by a given address
+// instead of replaying every block from genesis. The snapshot must hash to trustedHash and its headers
+// must lead from our genesis block to the snapshot's block, see verifySnapshot. The blocks after the
+// snapshot are then fetched in ranges of FETCH_BLOCK_NUMBER and validated on top of the snapshot state.
+// Returns a pointer to the bootstrapped blockchain and any errors encountered.
+func SyncBlockchainFromSnapshot(address string, genesisBlock *Block, trustedHash string) (*BlockchainCore, error) {
+	log.Println("Fetching state snapshot from:", address)
+	snapshot, err := FetchSnapshot(address)
+	if err != nil {
+		return nil, err
+	}
+
+	blocks, err := verifySnapshot(snapshot, genesisBlock, trustedHash)
 	if err != nil {
 		return nil, err
 	}
+	snapshot.Headers = nil
+
+	log.Println("Verified state snapshot at height:", snapshot.Height, "hash:", snapshot.Hash)
+
+	validator := newChainValidator(genesisBlock, snapshot, blocks)
+	for {
+		next := uint64(len(validator.chain))
+		fetched, err := FetchBlockRange(address, next, constants.FETCH_BLOCK_NUMBER)
+		if err != nil {
+			return nil, err
+		}
+		if len(fetched) == 0 {
+			break
+		}
+
+		for _, block := range fetched {
+			err = validator.connect(block)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	bs := new(BlockchainCore)
+	bs.TransactionPool = []*Transaction{}
+	bs.Blocks = validator.chain
+	bs.Peers = map[string]bool{}
+	bs.BaseSnapshot = snapshot
+
+	log.Println("Blockchain synced from snapshot:", address, "blocks after snapshot:", uint64(len(bs.Blocks))-snapshot.Height-1)
+
+	return bs, nil
+}
+
+// FetchSnapshot: retrieves the latest state snapshot of a peer, including the headers it covers
+func FetchSnapshot(address string) (*StateSnapshot, error) {
+	outURL := fmt.Sprintf("%s/snapshot", address)
+	resp, err := sendPeerRequest(http.MethodGet, outURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("peer %s responded with status %d", address, resp.StatusCode)
+	}
 
 	data, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, err
 	}
+
+	snapshot := new(StateSnapshot)
+	err = json.Unmarshal(data, snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	return snapshot, nil
+}
+
+// FetchBlockRange: retrieves up to count blocks of a peer starting at block number from
+// Returns an empty slice once from is past the peer's tip, and ErrBlocksPruned if the peer
+// does not store the blocks because from is at or below its snapshot height
+func FetchBlockRange(address string, from uint64, count int) ([]*Block, error) {
+	outURL := fmt.Sprintf("%s/blocks?from=%d&count=%d", address, from, count)
+	resp, err := sendPeerRequest(http.MethodGet, outURL, nil)
+	if err != nil {
+		return nil, err
+	}
 	defer resp.Body.Close()
 
-	var bs BlockchainCore
-	err = json.Unmarshal(data, &bs)
+	if resp.StatusCode == http.StatusGone {
+		return nil, fmt.Errorf("peer %s from height %d: %w", address, from, ErrBlocksPruned)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("peer %s responded with status %d", address, resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, err
 	}
 
-	log.Println("Blockchain synced:", address)
+	blocks := []*Block{}
+	err = json.Unmarshal(data, &blocks)
+	if err != nil {
+		return nil, err
+	}
+
+	return blocks, nil
+}
+
+// FetchFork: sends our block locator to a peer and retrieves the highest block of it the peer shares
+// with us, together with the hashes of up to FETCH_HEADER_NUMBER of the peer's blocks after it
+func FetchFork(address string, locator []string) (*LocatorFork, error) {
+	data, err := json.Marshal(struct {
+		Locator []string `json:"locator"`
+	}{locator})
+	if err != nil {
+		return nil, err
+	}
+
+	outURL := fmt.Sprintf("%s/locate-fork", address)
+	resp, err := sendPeerRequest(http.MethodPost, outURL, bytes.NewBuffer(data))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("peer %s responded with status %d", address, resp.StatusCode)
+	}
+
+	data, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	fork := new(LocatorFork)
+	err = json.Unmarshal(data, fork)
+	if err != nil {
+		return nil, err
+	}
+
+	return fork, nil
+}
 
-	return &bs, nil
+// FetchHeaderRange: retrieves up to count block headers of a peer starting at block number from
+// Returns an empty slice once from is past the peer's tip
+func FetchHeaderRange(address string, from uint64, count int) ([]BlockHeader, error) {
+	outURL := fmt.Sprintf("%s/headers?from=%d&count=%d", address, from, count)
+	resp, err := sendPeerRequest(http.MethodGet, outURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("peer %s responded with status %d", address, resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := []BlockHeader{}
+	err = json.Unmarshal(data, &headers)
+	if err != nil {
+		return nil, err
+	}
+
+	return headers, nil
+}
+
+// FetchChainWork: retrieves the tip block number and total work of a peer's chain
+func FetchChainWork(address string) (uint64, *big.Int, error) {
+	outURL := fmt.Sprintf("%s/chain-work", address)
+	resp, err := sendPeerRequest(http.MethodGet, outURL, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, nil, fmt.Errorf("peer %s responded with status %d", address, resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var x struct {
+		BlockNumber uint64 `json:"block_number"`
+		TotalWork   string `json:"total_work"`
+	}
+	err = json.Unmarshal(data, &x)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	work, ok := new(big.Int).SetString(x.TotalWork, 10)
+	if !ok {
+		return 0, nil, fmt.Errorf("peer %s reported invalid total work %q", address, x.TotalWork)
+	}
+
+	return x.BlockNumber, work, nil
+}
+
+// FetchPeers: retrieves the peer list of a peer
+func FetchPeers(address string) (map[string]bool, error) {
+	outURL := fmt.Sprintf("%s/peers", address)
+	resp, err := sendPeerRequest(http.MethodGet, outURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("peer %s responded with status %d", address, resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	peers := map[string]bool{}
+	err = json.Unmarshal(data, &peers)
+	if err != nil {
+		return nil, err
+	}
+
+	return peers, nil
 }
 
 // UpdatePeers: updates the peers map in the blockchain with the provided peers map.
 // Takes a map of peer addresses to boolean values. Uses mutex locking to ensure
-// thread safety when updating the peers. After updating, saves the blockchain state
+// thread safety when updating the peers. After updating, saves the peers
 // to the database.
 func (bc *BlockchainCore) UpdatePeers(peers map[string]bool) {
-	mutex.Lock()
-	defer mutex.Unlock()
+	bc.mutex.Lock()
+	defer bc.mutex.Unlock()
 
 	log.Println("Updating peers list...", peers)
 
 	bc.Peers = peers
 
-	err := DBAddBlockchain(*bc)
+	err := bc.store.SavePeers(bc.Peers)
 	if err != nil {
 		log.Fatal(err)
 	}
 }
 
+// GetPeers: returns a copy of the peers map taken under the mutex, so it can be iterated while the peers are updated
+func (bc *BlockchainCore) GetPeers() map[string]bool {
+	bc.mutex.Lock()
+	defer bc.mutex.Unlock()
+
+	peers := make(map[string]bool, len(bc.Peers))
+	for peer, status := range bc.Peers {
+		peers[peer] = status
+	}
+
+	return peers
+}
+
 // SendPeersList: sends the blockchain's peer list to a specified address via HTTP POST.
 // Converts the peer list to JSON and sends it to the /send-peers-list endpoint
 // at the given address.
 func (bc *BlockchainCore) SendPeersList(address string) {
 	data := bc.PeersToJson()
 	ourURL := fmt.Sprintf("%s/send-peers-list", address)
-	resp, err := http.Post(ourURL, "application/json", bytes.NewBuffer(data))
+	resp, err := sendPeerRequest(http.MethodPost, ourURL, bytes.NewBuffer(data))
 	if err != nil {
 		log.Printf("Error sending peers list: %v", err)
 		return
@@ -74,34 +317,45 @@ func (bc *BlockchainCore) SendPeersList(address string) {
 	defer resp.Body.Close()
 }
 
-// CheckStatus: checks if a blockchain server at the given address is available and running.
-// Makes an HTTP GET request to the server's status endpoint and verifies the response matches
-// the expected blockchain status value. Returns true if the server is running and accessible,
-// false otherwise.
-func (bc *BlockchainCore) CheckStatus(address string) bool {
-	outURL := fmt.Sprintf("%s/check-server-status", address)
-	resp, err := http.Get(outURL)
+// SendHandshake: sends our handshake to a specified peer address via HTTP POST to the peer's /handshake endpoint
+// Returns the peer's handshake, or an error if the peer could not be reached or rejected our handshake
+func SendHandshake(address string, h *Handshake) (*Handshake, error) {
+	data, err := json.Marshal(h)
+	if err != nil {
+		return nil, err
+	}
+
+	outURL := fmt.Sprintf("%s/handshake", address)
+	resp, err := sendPeerRequest(http.MethodPost, outURL, bytes.NewBuffer(data))
 	if err != nil {
-		log.Println("Error checking server status:", err)
-		return false
+		return nil, err
 	}
 	defer resp.Body.Close()
 
-	data, err := io.ReadAll(resp.Body)
+	data, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("peer %s rejected handshake: %s", address, strings.TrimSpace(string(data)))
+	}
+
+	peerHandshake := new(Handshake)
+	err = json.Unmarshal(data, peerHandshake)
 	if err != nil {
-		log.Println("Error reading server status response:", err)
-		return false
+		return nil, err
 	}
 
-	return string(data) == constants.BLOCKCHAIN_STATUS
+	return peerHandshake, nil
 }
 
 // BroadcastPeerList: broadcasts the blockchain's peer list to all active peers in the network.
-// Iterates through the peer list, sending the peer list to each active peer except itself.
+// Iterates through the peer list, sending the peer list to each active peer except itself and banned peers.
 // Includes a delay between broadcasts to prevent network congestion.
 func (bc *BlockchainCore) BroadcastPeerList() {
-	for peer, status := range bc.Peers {
-		if peer != bc.Address && status {
+	for peer, status := range bc.GetPeers() {
+		if peer != bc.Address && status && !bc.IsPeerBanned(peer) {
 			bc.SendPeersList(peer)
 			time.Sleep(constants.PEER_LIST_UPDATE_INTERVAL * time.Second)
 		}
@@ -109,8 +363,9 @@ func (bc *BlockchainCore) BroadcastPeerList() {
 }
 
 // DialUpdatePeers: continuously checks and updates the status of peers in the blockchain network.
-// Iterates through the peer list periodically, checking each peer's status via HTTP
-// and updating the peers map accordingly. The blockchain's own address is always marked as active.
+// Iterates through the peer list periodically, exchanging handshakes with each peer via HTTP
+// and updating the peers map accordingly. Peers that cannot be reached, are incompatible or are banned
+// are marked inactive. The blockchain's own address is always marked as active.
 // After updating peers, broadcasts the new peer list to the network and sleeps for the configured
 // ping interval before the next update cycle.
 func (bc *BlockchainCore) DialUpdatePeers() {
@@ -120,11 +375,18 @@ func (bc *BlockchainCore) DialUpdatePeers() {
 	for {
 		select {
 		case <-ticker.C:
-			log.Println("Pinging peers", bc.Peers)
+			peers := bc.GetPeers()
+			log.Println("Pinging peers", peers)
 			newList := make(map[string]bool)
-			for peer := range bc.Peers {
-				if peer != bc.Address {
-					newList[peer] = bc.CheckStatus(peer)
+			for peer := range peers {
+				if bc.IsPeerBanned(peer) {
+					newList[peer] = false
+				} else if peer != bc.Address {
+					err := bc.HandshakePeer(peer)
+					if err != nil {
+						log.Println("Handshake with peer failed:", peer, "Error:", err.Error())
+					}
+					newList[peer] = err == nil
 					time.Sleep(constants.PEER_PING_INTERVAL * time.Second)
 				} else {
 					newList[peer] = true
@@ -139,170 +401,139 @@ func (bc *BlockchainCore) DialUpdatePeers() {
 	}
 }
 
-// SendTransactionPeer: sends a transaction to a specified peer address via HTTP POST.
-// Takes the peer's address and a transaction pointer as input, converts the transaction
-// to JSON, and sends it to the peer's /send-transaction endpoint.
-func (bc *BlockchainCore) SendTransactionPeer(address string, txn *Transaction) {
-	data := txn.ToJson()
-	ourURL := fmt.Sprintf("%s/send-transaction", address)
-	http.Post(ourURL, "application/json", strings.NewReader(data))
-}
+// SendTransactionInventory: sends a transaction inventory to a specified peer address via HTTP POST
+// to the peer's /transaction-inventory endpoint
+func (bc *BlockchainCore) SendTransactionInventory(address string, inv *TransactionInventory) {
+	data, err := json.Marshal(inv)
+	if err != nil {
+		log.Printf("Error marshalling transaction inventory: %v", err)
+		return
+	}
 
-// BroadcastTransaction: broadcasts a transaction to all active peers in the network.
-// Iterates through the peer list, sending the transaction to each active peer except itself.
-// Includes a delay between broadcasts to prevent network congestion.
-func (bc *BlockchainCore) BroadcastTransaction(txn *Transaction) {
-	for peer, status := range bc.Peers {
-		if peer != bc.Address && status {
-			log.Println("Broadcasting transaction to peer:", peer, "transaction:", txn.ToJson())
-			bc.SendTransactionPeer(peer, txn)
-			time.Sleep(constants.PEER_LIST_UPDATE_INTERVAL * time.Second)
-		}
+	ourURL := fmt.Sprintf("%s/transaction-inventory", address)
+	resp, err := sendPeerRequest(http.MethodPost, ourURL, bytes.NewBuffer(data))
+	if err != nil {
+		log.Printf("Error sending transaction inventory: %v", err)
+		return
 	}
+	defer resp.Body.Close()
 }
 
-// FetchBlocks: fetches the last N blocks (defined by FETCH_BLOCK_NUMBER constant) from a given address.
-// Makes an HTTP GET request to the fetch-consensus-blocks endpoint, reads the response data,
-// and unmarshals it into a BlockchainCore struct. Returns a pointer to the blockchain containing
-// the fetched blocks and any errors encountered.
-func FetchBlocks(address string) (*BlockchainCore, error) {
-	log.Println("Fetching last", constants.FETCH_BLOCK_NUMBER, "blocks")
-	outURL := fmt.Sprintf("%s/fetch-consensus-blocks", address)
-	resp, err := http.Get(outURL)
+// FetchPoolTransactions: requests the transactions with the given hashes from the transaction pool of a peer
+// Transactions the peer no longer has in its pool are left out of the result
+func FetchPoolTransactions(address string, hashes []string) ([]*Transaction, error) {
+	data, err := json.Marshal(struct {
+		TransactionHashes []string `json:"transaction_hashes"`
+	}{hashes})
 	if err != nil {
 		return nil, err
 	}
 
-	data, err := io.ReadAll(resp.Body)
+	outURL := fmt.Sprintf("%s/get-transactions", address)
+	resp, err := sendPeerRequest(http.MethodPost, outURL, bytes.NewBuffer(data))
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
-	var bc BlockchainCore
-	err = json.Unmarshal(data, &bc)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("peer %s responded with status %d", address, resp.StatusCode)
+	}
+
+	data, err = io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, err
 	}
 
-	return &bc, nil
+	txns := []*Transaction{}
+	err = json.Unmarshal(data, &txns)
+	if err != nil {
+		return nil, err
+	}
+
+	return txns, nil
 }
 
-// verifyBlocks: verifies the integrity of a blockchain by checking block hashes and mining difficulty.
-// Takes a slice of Block pointers and returns true if all blocks are valid, false otherwise.
-// Validates that the genesis block and all subsequent blocks meet the required mining difficulty,
-// and that each block's previous hash matches the actual hash of the previous block.
-func verifyBlocks(chain []*Block) bool {
-	if chain[0].BlockNumber != 0 && chain[0].Hash()[2:2+constants.MINING_DIFFICULTY] != strings.Repeat("0", constants.MINING_DIFFICULTY) {
-		log.Println("Chain verification failed for block", chain[0].BlockNumber, "hash:", chain[0].Hash())
-		return false
+// UpdateBlockchain: updates the blockchain with a new chain of blocks. Takes a slice of new blocks
+// that has already passed ValidateChain and reorganizes our chain onto it from the common ancestor,
+// returning transactions of the disconnected blocks to the transaction pool. Thread-safe using mutex locks.
+// Blocks may have been connected since the new chain was validated, so the chain is only replaced if the
+// new chain still links to ours and has more work, checked under the same lock as the replacement.
+// After updating, replaces the disconnected blocks in the database with the connected ones, and a reorg
+// event is recorded whenever blocks of our chain were disconnected.
+// Returns whether our chain was replaced, and an error if the database could not be updated, in which case
+// our chain is reorganized back onto the blocks that are still stored
+func (bc *BlockchainCore) UpdateBlockchain(newChain []*Block) (bool, error) {
+	bc.mutex.Lock()
+	if !bc.extendsOurChain(newChain) || bc.candidateWork(newChain).Cmp(ChainWork(bc.Blocks)) <= 0 {
+		bc.mutex.Unlock()
+		return false, nil
 	}
 
-	for i := 1; i < len(chain); i++ {
-		if chain[i-1].Hash() != chain[i].PrevHash {
-			log.Println("Prev hash verification failed for block", chain[0].BlockNumber)
-			return false
-		}
+	oldBlocks := bc.Blocks
+	event := bc.reorganize(newChain)
 
-		if chain[i].Hash()[2:2+constants.MINING_DIFFICULTY] != strings.Repeat("0", constants.MINING_DIFFICULTY) {
-			log.Println("Chain verification failed for block", chain[0].BlockNumber, "hash:", chain[0].Hash())
-			return false
-		}
+	// Replace the disconnected blocks in the database with the connected ones
+	forkIndex := event.ForkHeight + 1
+	err := bc.store.Reorganize(forkIndex, forkIndex+event.Depth, bc.Blocks[forkIndex:], bc.TransactionPool)
+	if err != nil {
+		// The common ancestor is included so the rollback also works when no block was disconnected
+		bc.reorganize(oldBlocks[forkIndex-1:])
+		bc.mutex.Unlock()
+		return false, err
 	}
 
-	return true
-}
-
-// UpdateBlockchain: updates the blockchain with a new chain of blocks. Takes a slice of new blocks,
-// updates the blockchain's blocks array by appending the new chain at the correct position based on
-// block numbers, and updates the transaction pool by removing any transactions that are now included
-// in the blockchain. Thread-safe using mutex locks. After updating, saves the new blockchain state to  the database
-func (bc *BlockchainCore) UpdateBlockchain(newChain []*Block) {
-	mutex.Lock()
-	defer mutex.Unlock()
+	if event.Depth > 0 {
+		bc.recordReorg(event)
+	}
+	bc.mutex.Unlock()
 
-	blocks := []*Block{}
-	initIndex := newChain[0].BlockNumber
-	blocks = append(blocks, bc.Blocks[:initIndex]...)
-	blocks = append(blocks, newChain...)
+	bc.updateSnapshot()
 
-	bc.Blocks = blocks
+	return true, nil
+}
 
-	// Update transaction pool
-	found := map[string]bool{}
-	for _, txn := range bc.TransactionPool {
-		found[txn.TransactionHash] = false
+// SendBlockAnnouncement: sends a block announcement to a specified peer address via HTTP POST
+// to the peer's /receive-block endpoint
+func (bc *BlockchainCore) SendBlockAnnouncement(address string, ann *BlockAnnouncement) {
+	data, err := json.Marshal(ann)
+	if err != nil {
+		log.Printf("Error marshalling block announcement: %v", err)
+		return
 	}
 
-	for _, block := range newChain {
-		for _, txn := range block.Transactions {
-			_, ok := found[txn.TransactionHash]
-			if ok {
-				found[txn.TransactionHash] = true
-			}
-		}
-
-		newTxnPool := []*Transaction{}
-		for _, txn := range bc.TransactionPool {
-			if !found[txn.TransactionHash] {
-				newTxnPool = append(newTxnPool, txn)
-			}
-		}
-
-		bc.TransactionPool = newTxnPool
+	ourURL := fmt.Sprintf("%s/receive-block", address)
+	resp, err := sendPeerRequest(http.MethodPost, ourURL, bytes.NewBuffer(data))
+	if err != nil {
+		log.Printf("Error sending block announcement: %v", err)
+		return
+	}
+	defer resp.Body.Close()
+}
 
-		// Save the blockchain to the database
-		err := DBAddBlockchain(*bc)
-		if err != nil {
-			panic(err.Error())
+// AnnounceBlock: announces a block connected to our chain to all active peers in the network.
+// Peers that do not have the block yet fetch it from us, see ReceiveBlockAnnouncement. Banned peers are skipped.
+func (bc *BlockchainCore) AnnounceBlock(b *Block) {
+	ann := &BlockAnnouncement{BlockNumber: b.BlockNumber, BlockHash: b.Hash(), Address: bc.Address}
+	for peer, status := range bc.GetPeers() {
+		if peer != bc.Address && status && !bc.IsPeerBanned(peer) {
+			bc.SendBlockAnnouncement(peer, ann)
 		}
 	}
 }
 
+// RunConsensus: periodically syncs our chain with the chain of the active peer reporting the most
+// accumulated proof-of-work, see SyncManager. Downloaded chains that fail validation are ignored and
+// recorded as rejections.
+// Mining is paused while the blockchain is being replaced.
 func (bc *BlockchainCore) RunConsensus() {
 	for {
 		log.Println("Running consensus...")
-		longestChain := bc.Blocks
-		lengthOfTheLongestChain := bc.Blocks[len(bc.Blocks)-1].BlockNumber + 1
-		longestChainIsOur := true
-		for peer, status := range bc.Peers {
-			if peer != bc.Address && status {
-				bc1, err := FetchBlocks(peer)
-				if err != nil {
-					log.Println("Error while  fetching blocks from peer:", peer, "Error:", err.Error())
-					continue
-				}
-
-				lengthOfTheFetchedChain := bc1.Blocks[len(bc1.Blocks)-1].BlockNumber + 1
-				if lengthOfTheFetchedChain > lengthOfTheLongestChain {
-					longestChain = bc1.Blocks
-					lengthOfTheLongestChain = lengthOfTheFetchedChain
-					longestChainIsOur = false
-				}
-			}
-		}
-
-		if longestChainIsOur {
-			log.Println("Our chain is the longest, not updating.")
-			time.Sleep(constants.CONSENSUS_PAUSE_INTERVAL * time.Second)
-			continue
-		}
-
-		if verifyBlocks(longestChain) {
-			// Stop mining
-			bc.MiningLocked = true
-
-			bc.UpdateBlockchain(longestChain)
-
-			// Restart mining
-			bc.MiningLocked = false
-
-			log.Println("Blockchain update complete!")
-		} else {
-			log.Println("Chain Verification Failed, not updating my blockchain")
+		err := bc.Sync()
+		if err != nil {
+			log.Println("Error while syncing blockchain:", err.Error())
 		}
 
 		time.Sleep(constants.CONSENSUS_PAUSE_INTERVAL * time.Second)
 	}
-
 }
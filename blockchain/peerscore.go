@@ -0,0 +1,309 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/SunTzu71/suntzu_blockchain/constants"
+)
+
+// PeerBan is a peer we refuse to exchange blocks and transactions with until the Until timestamp
+type PeerBan struct {
+	Peer     string `json:"peer"`
+	Reason   string `json:"reason"`
+	BannedAt int64  `json:"banned_at"`
+	Until    int64  `json:"until"`
+}
+
+// PeerScore is the current score of a peer and the end of its ban if it is banned
+type PeerScore struct {
+	Peer        string `json:"peer"`
+	Score       int    `json:"score"`
+	Banned      bool   `json:"banned"`
+	BannedUntil int64  `json:"banned_until,omitempty"`
+}
+
+// peerScore is the score of a peer at the time it was last penalized
+type peerScore struct {
+	score   int
+	updated int64
+}
+
+// peerScores keeps the score and ban of every peer that misbehaved. Peers start at PEER_INITIAL_SCORE,
+// lose points for invalid data, malformed JSON and timeouts, and win back one point every PEER_SCORE_RECOVERY
+// seconds. A peer whose score drops below PEER_BAN_THRESHOLD is banned for PEER_BAN_DURATION seconds.
+// Bans are written to the store, so they survive a restart.
+type peerScores struct {
+	mutex  sync.Mutex
+	store  Store
+	scores map[string]*peerScore
+	bans   map[string]PeerBan
+}
+
+// newPeerScores creates the peer scores of a blockchain, loading the bans that have not expired from the store
+func newPeerScores(store Store) (*peerScores, error) {
+	bans, err := store.LoadBans()
+	if err != nil {
+		return nil, err
+	}
+
+	ps := &peerScores{store: store, scores: map[string]*peerScore{}, bans: map[string]PeerBan{}}
+	now := time.Now().Unix()
+	for _, ban := range bans {
+		if ban.Until > now {
+			ps.bans[ban.Peer] = ban
+		}
+	}
+
+	return ps, nil
+}
+
+// current returns the score of a peer including the points won back since it was last penalized.
+// Must be called with the mutex held.
+func (ps *peerScores) current(peer string, now int64) int {
+	s, ok := ps.scores[peer]
+	if !ok {
+		return constants.PEER_INITIAL_SCORE
+	}
+
+	recovered := int((now - s.updated) / constants.PEER_SCORE_RECOVERY)
+	return min(s.score+recovered, constants.PEER_INITIAL_SCORE)
+}
+
+// banned reports whether a peer is banned, forgetting its ban once it expired. Must be called with the mutex held.
+func (ps *peerScores) banned(peer string, now int64) bool {
+	ban, ok := ps.bans[peer]
+	if !ok {
+		return false
+	}
+	if ban.Until > now {
+		return true
+	}
+
+	delete(ps.bans, peer)
+	return false
+}
+
+// isBanned reports whether a peer is banned
+func (ps *peerScores) isBanned(peer string) bool {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	return ps.banned(peer, time.Now().Unix())
+}
+
+// penalize lowers the score of a peer and bans it once the score drops below PEER_BAN_THRESHOLD
+// Returns true if the peer was banned, and an error if the ban could not be saved
+func (ps *peerScores) penalize(peer string, penalty int, reason string) (bool, error) {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	now := time.Now().Unix()
+	if ps.banned(peer, now) {
+		return false, nil
+	}
+
+	score := ps.current(peer, now) - penalty
+	ps.scores[peer] = &peerScore{score: score, updated: now}
+	if score >= constants.PEER_BAN_THRESHOLD {
+		return false, nil
+	}
+
+	ps.bans[peer] = PeerBan{Peer: peer, Reason: reason, BannedAt: now, Until: now + constants.PEER_BAN_DURATION}
+
+	return true, ps.save()
+}
+
+// ban bans a peer until the ban's Until timestamp, replacing an earlier ban of the same peer
+func (ps *peerScores) ban(ban PeerBan) error {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	ps.bans[ban.Peer] = ban
+
+	return ps.save()
+}
+
+// unban lifts the ban of a peer and resets its score
+// Returns false if the peer was not banned
+func (ps *peerScores) unban(peer string) (bool, error) {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	if !ps.banned(peer, time.Now().Unix()) {
+		return false, nil
+	}
+
+	delete(ps.scores, peer)
+	delete(ps.bans, peer)
+
+	return true, ps.save()
+}
+
+// save writes the bans to the store. Must be called with the mutex held.
+func (ps *peerScores) save() error {
+	return ps.store.SaveBans(ps.sortedBans())
+}
+
+// sortedBans returns the bans sorted by peer. Must be called with the mutex held.
+func (ps *peerScores) sortedBans() []PeerBan {
+	bans := []PeerBan{}
+	for _, ban := range ps.bans {
+		bans = append(bans, ban)
+	}
+	sort.Slice(bans, func(i, j int) bool {
+		return bans[i].Peer < bans[j].Peer
+	})
+
+	return bans
+}
+
+// listBans returns the bans that have not expired, sorted by peer
+func (ps *peerScores) listBans() []PeerBan {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	now := time.Now().Unix()
+	for peer := range ps.bans {
+		ps.banned(peer, now)
+	}
+
+	return ps.sortedBans()
+}
+
+// list returns the score of every peer that is banned or below PEER_INITIAL_SCORE, sorted by peer.
+// Peers that won back their initial score are forgotten.
+func (ps *peerScores) list() []PeerScore {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	now := time.Now().Unix()
+	scores := []PeerScore{}
+	for peer, ban := range ps.bans {
+		if ps.banned(peer, now) {
+			scores = append(scores, PeerScore{Peer: peer, Score: ps.current(peer, now), Banned: true, BannedUntil: ban.Until})
+		}
+	}
+	for peer := range ps.scores {
+		if _, ok := ps.bans[peer]; ok {
+			continue
+		}
+
+		score := ps.current(peer, now)
+		if score == constants.PEER_INITIAL_SCORE {
+			delete(ps.scores, peer)
+			continue
+		}
+		scores = append(scores, PeerScore{Peer: peer, Score: score})
+	}
+	sort.Slice(scores, func(i, j int) bool {
+		return scores[i].Peer < scores[j].Peer
+	})
+
+	return scores
+}
+
+// errorPenalty: returns the score a peer loses for a request that failed with err
+// Only a *ValidationError, meaning the peer served a block or header breaking the consensus rules, costs
+// INVALID_DATA_PENALTY, unless the rejection is temporary, such as a timestamp ahead of our own clock.
+// Timeouts cost TIMEOUT_PENALTY and malformed JSON MALFORMED_DATA_PENALTY. Any other error costs nothing:
+// peers that cannot be reached are marked inactive by DialUpdatePeers, and error responses, blocks the peer
+// does not store (see ErrBlocksPruned) or a peer chain that changed during the sync are not misbehavior.
+func errorPenalty(err error) int {
+	var validationErr *ValidationError
+	var netErr net.Error
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &validationErr):
+		if validationErr.temporary {
+			return 0
+		}
+		return constants.INVALID_DATA_PENALTY
+	case errors.As(err, &netErr):
+		if netErr.Timeout() {
+			return constants.TIMEOUT_PENALTY
+		}
+		return 0
+	case errors.As(err, &syntaxErr), errors.As(err, &typeErr):
+		return constants.MALFORMED_DATA_PENALTY
+	default:
+		return 0
+	}
+}
+
+// PenalizePeer: lowers the score of a peer by penalty, banning it for PEER_BAN_DURATION seconds once
+// its score drops below PEER_BAN_THRESHOLD, see peerScores
+func (bc *BlockchainCore) PenalizePeer(peer string, penalty int, reason string) {
+	log.Println("Penalizing peer:", peer, "by", penalty, "Reason:", reason)
+
+	banned, err := bc.peerScores.penalize(peer, penalty, reason)
+	if err != nil {
+		log.Println("Error while saving peer bans:", err.Error())
+	}
+	if banned {
+		log.Println("Banned peer:", peer, "for", constants.PEER_BAN_DURATION, "seconds")
+	}
+}
+
+// penalizeError: penalizes a peer for a request that failed with err, see errorPenalty
+func (bc *BlockchainCore) penalizeError(peer string, err error) {
+	penalty := errorPenalty(err)
+	if penalty > 0 {
+		bc.PenalizePeer(peer, penalty, err.Error())
+	}
+}
+
+// IsPeerBanned: reports whether we refuse to exchange blocks and transactions with a peer
+func (bc *BlockchainCore) IsPeerBanned(peer string) bool {
+	return bc.peerScores.isBanned(peer)
+}
+
+// BanPeer: bans a peer for duration seconds, replacing an earlier ban of the peer
+// Returns an error if the ban could not be saved
+func (bc *BlockchainCore) BanPeer(peer string, duration int64, reason string) error {
+	log.Println("Banning peer:", peer, "for", duration, "seconds", "Reason:", reason)
+
+	now := time.Now().Unix()
+	return bc.peerScores.ban(PeerBan{Peer: peer, Reason: reason, BannedAt: now, Until: now + duration})
+}
+
+// UnbanPeer: lifts the ban of a peer and resets its score
+// Returns false if the peer was not banned, and an error if the bans could not be saved
+func (bc *BlockchainCore) UnbanPeer(peer string) (bool, error) {
+	log.Println("Unbanning peer:", peer)
+
+	return bc.peerScores.unban(peer)
+}
+
+// PenalizeClient: lowers the score of a client that sent us transactions, identified by its IP address, banning it
+// for PEER_BAN_DURATION seconds once its score drops below PEER_BAN_THRESHOLD. Client scores are kept apart from
+// the peer scores, so a client cannot get a peer on the same host banned, and client bans are not saved.
+func (bc *BlockchainCore) PenalizeClient(host string, penalty int, reason string) {
+	log.Println("Penalizing client:", host, "by", penalty, "Reason:", reason)
+
+	banned, _ := bc.clientScores.penalize(host, penalty, reason)
+	if banned {
+		log.Println("Banned client:", host, "for", constants.PEER_BAN_DURATION, "seconds")
+	}
+}
+
+// IsClientBanned: reports whether we refuse transactions sent by the client at an IP address
+func (bc *BlockchainCore) IsClientBanned(host string) bool {
+	return bc.clientScores.isBanned(host)
+}
+
+// GetPeerScores: returns the score of every peer that is banned or lost points, sorted by peer
+func (bc *BlockchainCore) GetPeerScores() []PeerScore {
+	return bc.peerScores.list()
+}
+
+// GetBannedPeers: returns the bans that have not expired, sorted by peer
+func (bc *BlockchainCore) GetBannedPeers() []PeerBan {
+	return bc.peerScores.listBans()
+}
@@ -0,0 +1,174 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/SunTzu71/suntzu_blockchain/constants"
+)
+
+func TestErrorPenalty(t *testing.T) {
+	syntaxErr := json.Unmarshal([]byte("{"), &struct{}{})
+	typeErr := json.Unmarshal([]byte(`{"block_number": "one"}`), &Block{})
+
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"invalid block", &ValidationError{Reason: "bad proof of work"}, constants.INVALID_DATA_PENALTY},
+		{"wrapped invalid block", fmt.Errorf("sync: %w", &ValidationError{Reason: "bad proof of work"}), constants.INVALID_DATA_PENALTY},
+		{"temporary rejection", &ValidationError{Reason: "timestamp in the future", temporary: true}, 0},
+		{"timeout", &net.DNSError{IsTimeout: true}, constants.TIMEOUT_PENALTY},
+		{"unreachable peer", &net.DNSError{IsNotFound: true}, 0},
+		{"malformed JSON", syntaxErr, constants.MALFORMED_DATA_PENALTY},
+		{"wrong JSON type", typeErr, constants.MALFORMED_DATA_PENALTY},
+		{"other error", errors.New("peer responded with status 500"), 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errorPenalty(tt.err); got != tt.want {
+				t.Errorf("errorPenalty(%v) = %d, want %d", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPenalize(t *testing.T) {
+	tests := []struct {
+		name       string
+		penalties  []int
+		wantBanned []bool
+		wantScore  int
+	}{
+		{"one penalty", []int{30}, []bool{false}, constants.PEER_INITIAL_SCORE - 30},
+		{"score at the threshold", []int{50, 50}, []bool{false, false}, constants.PEER_BAN_THRESHOLD},
+		{"score below the threshold", []int{50, 50, 1}, []bool{false, false, true}, constants.PEER_BAN_THRESHOLD - 1},
+		{"banned peer is not penalized again", []int{200, 10}, []bool{true, false}, constants.PEER_INITIAL_SCORE - 200},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ps, err := newPeerScores(NewMemoryStore())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i, penalty := range tt.penalties {
+				banned, err := ps.penalize("http://peer", penalty, "test")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if banned != tt.wantBanned[i] {
+					t.Errorf("penalty %d: penalize() = %v, want %v", i, banned, tt.wantBanned[i])
+				}
+			}
+
+			if score := ps.current("http://peer", time.Now().Unix()); score != tt.wantScore {
+				t.Errorf("score = %d, want %d", score, tt.wantScore)
+			}
+			if banned, want := ps.isBanned("http://peer"), slices.Contains(tt.wantBanned, true); banned != want {
+				t.Errorf("isBanned() = %v, want %v", banned, want)
+			}
+		})
+	}
+}
+
+func TestScoreRecovery(t *testing.T) {
+	ps, err := newPeerScores(NewMemoryStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().Unix()
+	ps.scores["http://peer"] = &peerScore{score: 40, updated: now - 10*constants.PEER_SCORE_RECOVERY}
+	ps.scores["http://recovered"] = &peerScore{score: 90, updated: now - 20*constants.PEER_SCORE_RECOVERY}
+
+	if score := ps.current("http://peer", now); score != 50 {
+		t.Errorf("score = %d, want 50 after ten recovery periods", score)
+	}
+	scores := ps.list()
+	if len(scores) != 1 || scores[0].Peer != "http://peer" {
+		t.Errorf("list() = %v, want only the peer still below its initial score", scores)
+	}
+}
+
+func TestBansSurviveRestart(t *testing.T) {
+	store := NewMemoryStore()
+	ps, err := newPeerScores(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().Unix()
+	if err := ps.ban(PeerBan{Peer: "http://banned", BannedAt: now, Until: now + 60}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ps.ban(PeerBan{Peer: "http://expired", BannedAt: now - 120, Until: now - 60}); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted, err := newPeerScores(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		peer string
+		want bool
+	}{
+		{"http://banned", true},
+		{"http://expired", false},
+		{"http://unknown", false},
+	}
+
+	for _, tt := range tests {
+		if got := restarted.isBanned(tt.peer); got != tt.want {
+			t.Errorf("isBanned(%q) = %v, want %v", tt.peer, got, tt.want)
+		}
+	}
+}
+
+func TestUnbanPeer(t *testing.T) {
+	bc := testBlockchain(0, "miner")
+	bc.PenalizePeer("http://banned", 200, "test")
+
+	tests := []struct {
+		peer string
+		want bool
+	}{
+		{"http://banned", true},
+		{"http://banned", false},
+		{"http://unknown", false},
+	}
+
+	for _, tt := range tests {
+		unbanned, err := bc.UnbanPeer(tt.peer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if unbanned != tt.want {
+			t.Errorf("UnbanPeer(%q) = %v, want %v", tt.peer, unbanned, tt.want)
+		}
+	}
+	if bc.IsPeerBanned("http://banned") || len(bc.GetPeerScores()) != 0 {
+		t.Errorf("unbanned peer kept its ban or score: %v", bc.GetPeerScores())
+	}
+}
+
+func TestClientScoresKeptApart(t *testing.T) {
+	bc := testBlockchain(0, "miner")
+
+	bc.PenalizeClient("127.0.0.1", 200, "test")
+
+	if !bc.IsClientBanned("127.0.0.1") {
+		t.Error("client was not banned")
+	}
+	if bc.IsPeerBanned("127.0.0.1") || len(bc.GetBannedPeers()) != 0 {
+		t.Errorf("client ban leaked into the peer bans: %v", bc.GetBannedPeers())
+	}
+}
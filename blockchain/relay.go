@@ -0,0 +1,216 @@
+package blockchain
+
+import (
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/SunTzu71/suntzu_blockchain/constants"
+)
+
+// BlockAnnouncement is the inventory a node sends its peers when a block is connected to its chain.
+// Address is the announcing node, which peers fetch the block from.
+type BlockAnnouncement struct {
+	BlockNumber uint64 `json:"block_number"`
+	BlockHash   string `json:"block_hash"`
+	Address     string `json:"address"`
+}
+
+// seenCache remembers up to size hashes, forgetting the oldest ones first, so announcements
+// relayed back and forth between peers are only processed once
+type seenCache struct {
+	mutex  sync.Mutex
+	size   int
+	hashes map[string]bool
+	order  []string
+}
+
+// newSeenCache creates an empty cache holding up to size hashes
+func newSeenCache(size int) *seenCache {
+	return &seenCache{size: size, hashes: map[string]bool{}, order: []string{}}
+}
+
+// add remembers a hash and reports whether it was not seen before
+func (sc *seenCache) add(hash string) bool {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+
+	if sc.hashes[hash] {
+		return false
+	}
+
+	sc.hashes[hash] = true
+	sc.order = append(sc.order, hash)
+	if len(sc.order) > sc.size {
+		delete(sc.hashes, sc.order[0])
+		sc.order = sc.order[1:]
+	}
+
+	return true
+}
+
+// remove forgets a hash so it is processed again the next time it is seen
+func (sc *seenCache) remove(hash string) {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+
+	delete(sc.hashes, hash)
+}
+
+// ReceiveBlockAnnouncement: handles a block announced by a peer. Announcements of peers we have not handshaken
+// with or that are banned, and of blocks already seen or already in our chain are ignored. Otherwise the block is
+// fetched from the announcing peer and processed with processBlock.
+func (bc *BlockchainCore) ReceiveBlockAnnouncement(ann *BlockAnnouncement) {
+	if !bc.IsHandshakenPeer(ann.Address) || bc.IsPeerBanned(ann.Address) {
+		return
+	}
+	if !bc.seenBlocks.add(ann.BlockHash) {
+		return
+	}
+	if _, ok := bc.index.BlockNumber(ann.BlockHash); ok {
+		return
+	}
+
+	log.Println("Received block announcement from peer:", ann.Address, "block number:", ann.BlockNumber, "hash:", ann.BlockHash)
+
+	block, err := fetchBlock(ann.Address, ann.BlockNumber, ann.BlockHash)
+	if err != nil {
+		log.Println("Error while fetching announced block:", err.Error())
+		bc.penalizeError(ann.Address, err)
+		bc.seenBlocks.remove(ann.BlockHash)
+		return
+	}
+
+	bc.processBlock(block, ann.Address)
+}
+
+// processBlock: handles a block received from a peer
+// 1. A block extending our tip is validated and connected with connectTip, which announces it to our own peers
+// in turn, then the orphans waiting for it are connected. If another block became the tip in the meantime,
+// the block is handled as a competing fork instead
+// 2. A block whose parent is in our chain but is not the tip starts a competing fork, so the peer's chain is
+// synced with SyncPeer, which switches to it only if it has more work
+// 3. A block whose parent we do not have is held in the orphan pool once its hash meets a plausible difficulty,
+// see checkOrphan, and its parent is fetched from the peer, repeating with the parent until one connects.
+// When the block is not above our tip, so it can only belong to a competing fork, when the peer is more than
+// MAX_ORPHAN_BLOCKS blocks ahead of us, or when the gap is still open after fetching MAX_ORPHAN_BLOCKS parents,
+// its chain is synced with SyncPeer instead.
+func (bc *BlockchainCore) processBlock(block *Block, peer string) {
+	for fetched := 0; ; fetched++ {
+		blocks := bc.GetBlocks()
+		tip := blocks[len(blocks)-1]
+		if block.PrevHash == tip.Hash() {
+			connected, err := bc.connectTip(block)
+			if err != nil {
+				// The header may be valid with a malleated body, so the block can still be fetched from another peer
+				bc.seenBlocks.remove(block.Hash())
+				bc.recordRejection(peer, err)
+				return
+			}
+
+			if connected {
+				bc.connectOrphans(block.Hash())
+				return
+			}
+
+			// Another block was connected first, so the block now starts a competing fork
+			continue
+		}
+
+		_, parentKnown := bc.index.BlockNumber(block.PrevHash)
+		if parentKnown || block.BlockNumber <= tip.BlockNumber || block.BlockNumber > tip.BlockNumber+constants.MAX_ORPHAN_BLOCKS || fetched >= constants.MAX_ORPHAN_BLOCKS {
+			err := bc.syncManager.SyncPeer(peer)
+			if err != nil {
+				log.Println("Error while syncing from peer:", peer, "Error:", err.Error())
+			}
+			return
+		}
+
+		err := checkOrphan(tip, block)
+		if err != nil {
+			bc.seenBlocks.remove(block.Hash())
+			bc.recordRejection(peer, err)
+			return
+		}
+
+		if !bc.orphans.add(block, peer) {
+			return
+		}
+
+		log.Println("Holding orphan block:", block.BlockNumber, "fetching parent", block.PrevHash, "from peer:", peer)
+
+		bc.seenBlocks.add(block.PrevHash)
+		parent, err := fetchBlock(peer, block.BlockNumber-1, block.PrevHash)
+		if err != nil {
+			log.Println("Error while fetching parent block:", err.Error())
+			bc.penalizeError(peer, err)
+			bc.seenBlocks.remove(block.PrevHash)
+			return
+		}
+
+		block = parent
+	}
+}
+
+// checkOrphan: checks the proof-of-work of a block whose parent we do not have, so forged blocks are neither
+// held nor make us fetch their parents. The difficulty changes by at most one every DIFFICULTY_ADJUSTMENT_INTERVAL
+// blocks, so the block must claim a difficulty our tip's difficulty could have dropped to by its height, and its
+// hash must meet it. The full header is validated with the rest of the block once its parent is connected.
+// Returns a *ValidationError if the block is not above our tip or cannot be part of a valid chain.
+func checkOrphan(tip *Block, b *Block) error {
+	if b.BlockNumber <= tip.BlockNumber {
+		return newValidationError(b, "orphan is not above our tip %d", tip.BlockNumber)
+	}
+
+	adjustments := int((b.BlockNumber-tip.BlockNumber)/constants.DIFFICULTY_ADJUSTMENT_INTERVAL) + 1
+	minDifficulty := max(tip.Difficulty-adjustments, constants.MIN_MINING_DIFFICULTY)
+	if b.Difficulty < minDifficulty {
+		return newValidationError(b, "orphan difficulty %d is below %d", b.Difficulty, minDifficulty)
+	}
+
+	if !meetsDifficulty(b.Hash(), b.Difficulty) {
+		return newValidationError(b, "hash does not meet difficulty %d", b.Difficulty)
+	}
+
+	return nil
+}
+
+// connectOrphans: connects the orphans waiting for the block with the given hash, then the orphans
+// waiting for those in turn. Orphans that fail validation are recorded as rejections of the peer they came from.
+func (bc *BlockchainCore) connectOrphans(parentHash string) {
+	parents := []string{parentHash}
+	for len(parents) > 0 {
+		children := bc.orphans.take(parents[0])
+		parents = parents[1:]
+
+		for _, orphan := range children {
+			connected, err := bc.connectTip(orphan.block)
+			if err != nil {
+				bc.seenBlocks.remove(orphan.block.Hash())
+				bc.recordRejection(orphan.peer, err)
+				continue
+			}
+
+			// A sibling may have been connected first
+			if !connected {
+				continue
+			}
+
+			log.Println("Connected orphan block:", orphan.block.BlockNumber, "from peer:", orphan.peer)
+			parents = append(parents, orphan.block.Hash())
+		}
+	}
+}
+
+// fetchBlock: fetches the block with the given number from a peer and checks it has the expected number and hash
+func fetchBlock(address string, blockNumber uint64, blockHash string) (*Block, error) {
+	blocks, err := FetchBlockRange(address, blockNumber, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(blocks) != 1 || blocks[0].BlockNumber != blockNumber || blocks[0].Hash() != blockHash {
+		return nil, fmt.Errorf("peer %s did not return block %d %s", address, blockNumber, blockHash)
+	}
+
+	return blocks[0], nil
+}
@@ -0,0 +1,97 @@
+package blockchain
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSeenCache(t *testing.T) {
+	sc := newSeenCache(2)
+
+	steps := []struct {
+		op   string
+		hash string
+		want bool
+	}{
+		{"add", "a", true},
+		{"add", "a", false},
+		{"add", "b", true},
+		{"add", "c", true},
+		{"add", "b", false},
+		{"add", "a", true},
+		{"remove", "a", false},
+		{"add", "a", true},
+	}
+
+	for i, step := range steps {
+		if step.op == "remove" {
+			sc.remove(step.hash)
+			continue
+		}
+		if got := sc.add(step.hash); got != step.want {
+			t.Errorf("step %d: add(%q) = %v, want %v", i, step.hash, got, step.want)
+		}
+	}
+}
+
+func TestConnectTip(t *testing.T) {
+	tests := []struct {
+		name          string
+		block         func(chain []*Block) *Block
+		wantConnected bool
+		wantErr       bool
+	}{
+		{"extends our tip", func(chain []*Block) *Block {
+			return testMineBlock(chain, nil, "miner")
+		}, true, false},
+		{"parent is not our tip", func(chain []*Block) *Block {
+			return testMineBlock(chain[:2], nil, "other")
+		}, false, false},
+		{"invalid block", func(chain []*Block) *Block {
+			block := testMineBlock(chain, nil, "miner")
+			block.Transactions[0].Value++
+			block.Transactions[0].TransactionHash = block.Transactions[0].Hash()
+			testRemine(block)
+			return block
+		}, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bc := testBlockchain(2, "miner")
+			oldTip := bc.Blocks[len(bc.Blocks)-1].Hash()
+			block := tt.block(bc.Blocks)
+
+			connected, err := bc.connectTip(block)
+			if connected != tt.wantConnected || (err != nil) != tt.wantErr {
+				t.Fatalf("connectTip() = %v, %v, want %v and error %v", connected, err, tt.wantConnected, tt.wantErr)
+			}
+			var validationErr *ValidationError
+			if tt.wantErr && !errors.As(err, &validationErr) {
+				t.Errorf("connectTip() error = %v, want a *ValidationError", err)
+			}
+
+			wantTip := oldTip
+			if tt.wantConnected {
+				wantTip = block.Hash()
+			}
+			if tip := bc.Blocks[len(bc.Blocks)-1].Hash(); tip != wantTip {
+				t.Errorf("tip = %s, want %s", tip, wantTip)
+			}
+			if _, indexed := bc.index.BlockNumber(block.Hash()); indexed != tt.wantConnected {
+				t.Errorf("block indexed = %v, want %v", indexed, tt.wantConnected)
+			}
+		})
+	}
+}
+
+func TestReceiveBlockAnnouncementIgnoresUnknownPeers(t *testing.T) {
+	bc := testBlockchain(1, "miner")
+	ann := &BlockAnnouncement{BlockNumber: 2, BlockHash: "0xabc", Address: "http://127.0.0.1:1"}
+
+	bc.ReceiveBlockAnnouncement(ann)
+
+	if !bc.seenBlocks.add(ann.BlockHash) {
+		t.Error("announcement of a peer we have not handshaken with was processed")
+	}
+}
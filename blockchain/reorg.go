@@ -0,0 +1,153 @@
+package blockchain
+
+import (
+	"log"
+	"time"
+
+	"github.com/SunTzu71/suntzu_blockchain/constants"
+)
+
+// ReorgEvent describes a chain reorganization where blocks of our chain were replaced
+// by the blocks of a chain with more work
+type ReorgEvent struct {
+	ForkHeight           uint64 `json:"fork_height"`
+	Depth                uint64 `json:"depth"`
+	ConnectedBlocks      uint64 `json:"connected_blocks"`
+	OldTip               string `json:"old_tip"`
+	NewTip               string `json:"new_tip"`
+	RestoredTransactions int    `json:"restored_transactions"`
+	Timestamp            int64  `json:"timestamp"`
+}
+
+// findForkIndex: returns the index of the first block of newChain that is not part of our chain.
+// All blocks of our chain below the returned index are shared with newChain, so the block at
+// index-1 is the common ancestor.
+func (bc *BlockchainCore) findForkIndex(newChain []*Block) uint64 {
+	for _, block := range newChain {
+		if block.BlockNumber >= uint64(len(bc.Blocks)) || bc.Blocks[block.BlockNumber].Hash() != block.Hash() {
+			return block.BlockNumber
+		}
+	}
+
+	return newChain[len(newChain)-1].BlockNumber + 1
+}
+
+// reorganize: replaces our blocks after the common ancestor with the blocks of newChain.
+// Non-reward transactions of the disconnected blocks that are not part of the new chain are
+// returned to the transaction pool, and the whole pool is re-validated against the new tip.
+// Returns the resulting ReorgEvent. Must be called with the mutex held.
+func (bc *BlockchainCore) reorganize(newChain []*Block) ReorgEvent {
+	oldTip := bc.Blocks[len(bc.Blocks)-1].Hash()
+	forkIndex := bc.findForkIndex(newChain)
+
+	disconnected := bc.Blocks[forkIndex:]
+	connected := newChain[forkIndex-newChain[0].BlockNumber:]
+
+	blocks := []*Block{}
+	blocks = append(blocks, bc.Blocks[:forkIndex]...)
+	blocks = append(blocks, connected...)
+	bc.Blocks = blocks
+
+	// Move the chain index back to the fork point and onto the new chain
+	for i := len(disconnected) - 1; i >= 0; i-- {
+		bc.index.disconnectBlock(disconnected[i])
+	}
+	for _, block := range connected {
+		bc.index.connectBlock(block)
+	}
+
+	// Transactions from the disconnected blocks go back into the pool ahead of the
+	// pending ones, since they were created first
+	restored := []*Transaction{}
+	for _, block := range disconnected {
+		for _, txn := range block.Transactions {
+			if txn.From != constants.BLOCKCHAIN_ADDRESS && txn.Status == constants.SUCCESS {
+				restoredTxn := *txn
+				restored = append(restored, &restoredTxn)
+			}
+		}
+	}
+
+	restoredCount := bc.revalidateTransactionPool(restored)
+
+	event := ReorgEvent{
+		ForkHeight:           forkIndex - 1,
+		Depth:                uint64(len(disconnected)),
+		ConnectedBlocks:      uint64(len(connected)),
+		OldTip:               oldTip,
+		NewTip:               bc.Blocks[len(bc.Blocks)-1].Hash(),
+		RestoredTransactions: restoredCount,
+		Timestamp:            time.Now().Unix(),
+	}
+
+	return event
+}
+
+// revalidateTransactionPool: rebuilds the transaction pool on top of the current tip.
+// Restored transactions are checked first followed by the pending pool; transactions already
+// included in the chain are dropped and the remaining ones are replayed against the state of
+// the chain index, which must already be at the tip. Transactions that are no longer valid are
+// dropped.
+// Returns the number of restored transactions added back to the pool.
+// Must be called with the mutex held.
+func (bc *BlockchainCore) revalidateTransactionPool(restored []*Transaction) int {
+	included := map[string]bool{}
+	state := bc.index.State()
+	newTxnPool := []*Transaction{}
+	restoredCount := 0
+
+	for _, txn := range restored {
+		if included[txn.TransactionHash] || bc.isTransactionInChain(txn.TransactionHash) {
+			continue
+		}
+		included[txn.TransactionHash] = true
+
+		if state.canApply(txn) {
+			state.applyTransaction(txn)
+			txn.Status = constants.TRANSACTION_VERIFY_SUCCESS
+			newTxnPool = append(newTxnPool, txn)
+			restoredCount++
+		}
+	}
+
+	for _, txn := range bc.TransactionPool {
+		if included[txn.TransactionHash] || bc.isTransactionInChain(txn.TransactionHash) {
+			continue
+		}
+		included[txn.TransactionHash] = true
+
+		if state.canApply(txn) {
+			state.applyTransaction(txn)
+			txn.Status = constants.TRANSACTION_VERIFY_SUCCESS
+			newTxnPool = append(newTxnPool, txn)
+		}
+	}
+
+	bc.TransactionPool = newTxnPool
+	bc.poolUpdates.Add(1)
+
+	return restoredCount
+}
+
+// recordReorg: logs a reorganization and keeps it in the list of recent reorg events,
+// dropping the oldest entries beyond MAX_REORG_EVENTS. Must be called with the mutex held.
+func (bc *BlockchainCore) recordReorg(event ReorgEvent) {
+	log.Println("Chain reorganized at height", event.ForkHeight, "depth:", event.Depth,
+		"old tip:", event.OldTip, "new tip:", event.NewTip, "restored transactions:", event.RestoredTransactions)
+
+	bc.reorgEvents = append(bc.reorgEvents, event)
+	if len(bc.reorgEvents) > constants.MAX_REORG_EVENTS {
+		bc.reorgEvents = bc.reorgEvents[len(bc.reorgEvents)-constants.MAX_REORG_EVENTS:]
+	}
+}
+
+// GetReorgEvents: returns a copy of the most recent reorg events, oldest first
+func (bc *BlockchainCore) GetReorgEvents() []ReorgEvent {
+	bc.mutex.Lock()
+	defer bc.mutex.Unlock()
+
+	events := make([]ReorgEvent, len(bc.reorgEvents))
+	copy(events, bc.reorgEvents)
+
+	return events
+}
@@ -0,0 +1,92 @@
+package blockchain
+
+import (
+	"errors"
+	"testing"
+)
+
+// failingReorgStore is a store kept in memory whose Reorganize always fails
+type failingReorgStore struct {
+	*MemoryStore
+}
+
+func (s failingReorgStore) Reorganize(forkIndex uint64, oldLength uint64, connected []*Block, pool []*Transaction) error {
+	return errors.New("disk full")
+}
+
+func TestReorganizeRestoresTransactions(t *testing.T) {
+	tests := []struct {
+		name          string
+		forkIncludes  bool
+		wantPool      int
+		wantRestored  int
+		wantRecipient uint64
+	}{
+		{"transaction only on the old branch", false, 1, 1, 0},
+		{"transaction also on the new branch", true, 0, 0, 600},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sender := newTestKey(t)
+			bc := testFundedBlockchain(sender.address, 1000)
+			txn := sender.transfer(t, "receiver", 600, 10, 0)
+			bc.AddBlock(testMineBlock(bc.Blocks, []*Transaction{txn}, "ours"))
+
+			fork := []*Block{bc.Blocks[0]}
+			if tt.forkIncludes {
+				fork = append(fork, testMineBlock(fork, []*Transaction{txn}, "theirs"))
+			}
+			fork = testExtendChain(fork, 3-len(fork), "theirs")
+
+			replaced, err := bc.UpdateBlockchain(fork[1:])
+			if err != nil || !replaced {
+				t.Fatalf("UpdateBlockchain() = %v, %v, want true, nil", replaced, err)
+			}
+
+			if len(bc.TransactionPool) != tt.wantPool {
+				t.Errorf("pool holds %d transactions, want %d", len(bc.TransactionPool), tt.wantPool)
+			}
+			if balance := bc.index.Balance("receiver"); balance != tt.wantRecipient {
+				t.Errorf("receiver balance = %d, want %d", balance, tt.wantRecipient)
+			}
+
+			events := bc.GetReorgEvents()
+			if len(events) != 1 {
+				t.Fatalf("recorded %d reorg events, want 1", len(events))
+			}
+			if events[0].ForkHeight != 0 || events[0].Depth != 1 || events[0].RestoredTransactions != tt.wantRestored {
+				t.Errorf("reorg event = %+v, want fork height 0, depth 1 and %d restored", events[0], tt.wantRestored)
+			}
+		})
+	}
+}
+
+func TestUpdateBlockchainRollsBackOnStoreFailure(t *testing.T) {
+	sender := newTestKey(t)
+	genesis := testFundedBlockchain(sender.address, 1000).Blocks[0]
+	bc := NewBlockchain(*genesis, "", failingReorgStore{NewMemoryStore()})
+
+	txn := sender.transfer(t, "receiver", 600, 10, 0)
+	bc.AddBlock(testMineBlock(bc.Blocks, []*Transaction{txn}, "ours"))
+	oldTip := bc.Blocks[len(bc.Blocks)-1].Hash()
+
+	fork := testExtendChain(bc.Blocks[:1], 3, "theirs")
+	replaced, err := bc.UpdateBlockchain(fork[1:])
+	if err == nil || replaced {
+		t.Fatalf("UpdateBlockchain() = %v, %v, want false and an error", replaced, err)
+	}
+
+	if tip := bc.Blocks[len(bc.Blocks)-1].Hash(); tip != oldTip {
+		t.Errorf("tip = %s, want %s", tip, oldTip)
+	}
+	if balance := bc.index.Balance("receiver"); balance != 600 {
+		t.Errorf("receiver balance = %d, want 600", balance)
+	}
+	if len(bc.TransactionPool) != 0 {
+		t.Errorf("pool holds %d transactions, want 0", len(bc.TransactionPool))
+	}
+	if events := bc.GetReorgEvents(); len(events) != 0 {
+		t.Errorf("recorded %d reorg events, want 0", len(events))
+	}
+}
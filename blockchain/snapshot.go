@@ -0,0 +1,250 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/SunTzu71/suntzu_blockchain/constants"
+)
+
+// StateSnapshot holds the account state of the chain after the block at Height. Its Hash commits
+// to the chain ID, height, block hash, balances, nonces and immature rewards, so a node that trusts
+// the hash can start from the snapshot instead of replaying every block from genesis.
+// Headers carries the headers of blocks 0 to Height when a snapshot is served to other nodes.
+type StateSnapshot struct {
+	ChainID   string        `json:"chain_id"`
+	Height    uint64        `json:"height"`
+	BlockHash string        `json:"block_hash"`
+	State     *ChainState   `json:"state"`
+	Hash      string        `json:"hash"`
+	Headers   []BlockHeader `json:"headers,omitempty"`
+}
+
+// Copy returns a deep copy of the chain state
+func (cs *ChainState) Copy() *ChainState {
+	copied := NewChainState()
+	for address, balance := range cs.Balances {
+		copied.Balances[address] = balance
+	}
+	for address, nonce := range cs.Nonces {
+		copied.Nonces[address] = nonce
+	}
+	copied.Immature = append(copied.Immature, cs.Immature...)
+
+	return copied
+}
+
+// NewStateSnapshot creates a snapshot of the state after the last of the given blocks.
+// When base is not nil the blocks up to its height only hold headers and the state is replayed from base.
+func NewStateSnapshot(base *StateSnapshot, blocks []*Block) *StateSnapshot {
+	tip := blocks[len(blocks)-1]
+
+	s := new(StateSnapshot)
+	s.ChainID = constants.CHAIN_ID
+	s.Height = tip.BlockNumber
+	s.BlockHash = tip.Hash()
+	s.State = replayState(base, blocks)
+	s.Hash = s.ComputeHash()
+
+	return s
+}
+
+// ComputeHash returns the hash of the canonical encoding of the snapshot: a version byte, the chain ID,
+// height and block hash followed by the balances and nonces sorted by address and the immature rewards in order
+func (s *StateSnapshot) ComputeHash() string {
+	buf := new(bytes.Buffer)
+	buf.WriteByte(constants.SNAPSHOT_ENCODING_VERSION)
+	writeString(buf, s.ChainID)
+	writeUint64(buf, s.Height)
+	writeString(buf, s.BlockHash)
+
+	writeSortedMap(buf, s.State.Balances)
+	writeSortedMap(buf, s.State.Nonces)
+
+	writeUint64(buf, uint64(len(s.State.Immature)))
+	for _, reward := range s.State.Immature {
+		writeUint64(buf, reward.BlockNumber)
+		writeString(buf, reward.Address)
+		writeUint64(buf, reward.Value)
+	}
+
+	sum := sha256.Sum256(buf.Bytes())
+
+	return constants.HEX_PREFIX + hex.EncodeToString(sum[:])
+}
+
+// writeSortedMap: writes the number of entries of a map followed by its entries sorted by key
+func writeSortedMap(buf *bytes.Buffer, m map[string]uint64) {
+	keys := []string{}
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	writeUint64(buf, uint64(len(keys)))
+	for _, key := range keys {
+		writeString(buf, key)
+		writeUint64(buf, m[key])
+	}
+}
+
+// replayState returns the state after the last of the given blocks. Without a base every block is
+// replayed from genesis, otherwise only the blocks after the base snapshot's height are applied to its state.
+func replayState(base *StateSnapshot, blocks []*Block) *ChainState {
+	if base == nil {
+		return NewChainStateFromBlocks(blocks)
+	}
+
+	state := base.State.Copy()
+	for _, block := range blocks[base.Height+1:] {
+		state.ApplyBlock(block)
+	}
+
+	return state
+}
+
+// snapshotHeight returns the height of the snapshot a chain with the given tip should provide:
+// the highest multiple of SNAPSHOT_INTERVAL at least SNAPSHOT_CONFIRMATIONS blocks below the tip
+func snapshotHeight(tip uint64) uint64 {
+	if tip < constants.SNAPSHOT_CONFIRMATIONS {
+		return 0
+	}
+
+	return (tip - constants.SNAPSHOT_CONFIRMATIONS) / constants.SNAPSHOT_INTERVAL * constants.SNAPSHOT_INTERVAL
+}
+
+// updateSnapshot: produces a new snapshot once the chain has grown past the next snapshot height,
+// or when a reorganization replaced the block of the current snapshot, and drops the current snapshot
+// when the chain no longer reaches a snapshot height. The state is replayed from the current snapshot
+// when it is still part of the chain and from the base snapshot or genesis otherwise. The replay runs
+// without holding the mutex, so the mutex must not be held by the caller.
+func (bc *BlockchainCore) updateSnapshot() {
+	bc.mutex.Lock()
+	blocks := bc.Blocks
+	base := bc.BaseSnapshot
+	current := bc.latestSnapshot
+
+	height := snapshotHeight(blocks[len(blocks)-1].BlockNumber)
+	if height == 0 || (base != nil && height < base.Height) {
+		bc.latestSnapshot = nil
+		bc.mutex.Unlock()
+		return
+	}
+
+	if current != nil && current.Height == height && current.BlockHash == blocks[height].Hash() {
+		bc.mutex.Unlock()
+		return
+	}
+	bc.mutex.Unlock()
+
+	from := base
+	if current != nil && current.Height < height && current.BlockHash == blocks[current.Height].Hash() {
+		from = current
+	}
+	snapshot := NewStateSnapshot(from, blocks[:height+1])
+
+	bc.mutex.Lock()
+	defer bc.mutex.Unlock()
+
+	// The chain may have been reorganized while replaying, in which case the
+	// update following the reorganization produces the snapshot
+	if !bc.hasSnapshotBlock(snapshot) {
+		return
+	}
+
+	if bc.latestSnapshot != nil && bc.latestSnapshot.Height > height && bc.hasSnapshotBlock(bc.latestSnapshot) {
+		return
+	}
+
+	bc.latestSnapshot = snapshot
+	log.Println("Created state snapshot at height:", height, "hash:", snapshot.Hash)
+}
+
+// hasSnapshotBlock: reports whether the block a snapshot was taken after is part of our chain.
+// Must be called with the mutex held.
+func (bc *BlockchainCore) hasSnapshotBlock(s *StateSnapshot) bool {
+	return s.Height < uint64(len(bc.Blocks)) && bc.Blocks[s.Height].Hash() == s.BlockHash
+}
+
+// GetSnapshot: returns the latest state snapshot with the headers of the blocks it covers
+// Returns an error if the chain is not long enough to have produced a snapshot yet, or if the
+// snapshot was taken on blocks a reorganization replaced and has not been produced again yet
+func (bc *BlockchainCore) GetSnapshot() (*StateSnapshot, error) {
+	bc.mutex.Lock()
+	defer bc.mutex.Unlock()
+
+	if bc.latestSnapshot == nil {
+		return nil, errors.New("no state snapshot available yet")
+	}
+
+	if !bc.hasSnapshotBlock(bc.latestSnapshot) {
+		return nil, errors.New("state snapshot is not part of our chain")
+	}
+
+	snapshot := *bc.latestSnapshot
+	snapshot.Headers = []BlockHeader{}
+	for _, block := range bc.Blocks[:snapshot.Height+1] {
+		snapshot.Headers = append(snapshot.Headers, block.Header())
+	}
+
+	return &snapshot, nil
+}
+
+// HasBlockBodies: reports whether we store the transactions of the blocks from block number from on.
+// A node started from a snapshot only holds the headers of the blocks up to the snapshot's height.
+func (bc *BlockchainCore) HasBlockBodies(from uint64) bool {
+	return bc.BaseSnapshot == nil || from > bc.BaseSnapshot.Height
+}
+
+// verifySnapshot: checks a snapshot received from a peer against the hash we trust and returns the
+// chain of header-only blocks it covers. The snapshot must belong to our chain, hash to trustedHash,
+// and its headers must start at our genesis block, pass header validation and end at the snapshot's block.
+func verifySnapshot(s *StateSnapshot, genesisBlock *Block, trustedHash string) ([]*Block, error) {
+	if s.ChainID != constants.CHAIN_ID {
+		return nil, fmt.Errorf("snapshot chain id %q does not match %q", s.ChainID, constants.CHAIN_ID)
+	}
+
+	if s.State == nil || s.ComputeHash() != s.Hash || s.Hash != trustedHash {
+		return nil, fmt.Errorf("snapshot hash %s does not match trusted hash %s", s.Hash, trustedHash)
+	}
+
+	if uint64(len(s.Headers)) != s.Height+1 || s.Headers[0].Hash() != genesisBlock.Hash() {
+		return nil, errors.New("snapshot headers do not start at our genesis block")
+	}
+
+	blocks := []*Block{genesisBlock}
+	for _, header := range s.Headers[1:] {
+		block := headerBlock(header)
+		err := validateHeader(blocks, block)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, block)
+	}
+
+	if blocks[len(blocks)-1].Hash() != s.BlockHash {
+		return nil, fmt.Errorf("snapshot headers do not end at block %s", s.BlockHash)
+	}
+
+	return blocks, nil
+}
+
+// headerBlock: returns a block holding only the given header, used for the blocks covered by a snapshot
+func headerBlock(h BlockHeader) *Block {
+	return &Block{
+		ChainID:          h.ChainID,
+		BlockNumber:      h.BlockNumber,
+		PrevHash:         h.PrevHash,
+		Timestamp:        h.Timestamp,
+		Nonce:            h.Nonce,
+		Difficulty:       h.Difficulty,
+		CoinbaseMaturity: h.CoinbaseMaturity,
+		MerkleRoot:       h.MerkleRoot,
+		Transactions:     []*Transaction{},
+	}
+}
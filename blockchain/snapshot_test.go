@@ -0,0 +1,190 @@
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/SunTzu71/suntzu_blockchain/constants"
+)
+
+// testServedSnapshot returns the snapshot of chain after the block at height with the headers it covers
+func testServedSnapshot(chain []*Block, height int) *StateSnapshot {
+	s := NewStateSnapshot(nil, chain[:height+1])
+	for _, block := range chain[:height+1] {
+		s.Headers = append(s.Headers, block.Header())
+	}
+
+	return s
+}
+
+func TestSnapshotHeight(t *testing.T) {
+	const interval = constants.SNAPSHOT_INTERVAL
+	const confirmations = constants.SNAPSHOT_CONFIRMATIONS
+
+	tests := []struct {
+		tip  uint64
+		want uint64
+	}{
+		{0, 0},
+		{confirmations - 1, 0},
+		{interval + confirmations - 1, 0},
+		{interval + confirmations, interval},
+		{2*interval + confirmations - 1, interval},
+		{2*interval + confirmations, 2 * interval},
+	}
+
+	for _, tt := range tests {
+		if got := snapshotHeight(tt.tip); got != tt.want {
+			t.Errorf("snapshotHeight(%d) = %d, want %d", tt.tip, got, tt.want)
+		}
+	}
+}
+
+func TestStateSnapshotHash(t *testing.T) {
+	chain := testBlockchain(4, "miner").Blocks
+
+	tests := []struct {
+		name      string
+		change    func(s *StateSnapshot)
+		wantEqual bool
+	}{
+		{"same state", func(s *StateSnapshot) {}, true},
+		{"replayed from a base snapshot", func(s *StateSnapshot) {
+			*s = *NewStateSnapshot(NewStateSnapshot(nil, chain[:2]), chain)
+		}, true},
+		{"chain id", func(s *StateSnapshot) { s.ChainID = "suntzuchain-testnet" }, false},
+		{"height", func(s *StateSnapshot) { s.Height++ }, false},
+		{"block hash", func(s *StateSnapshot) { s.BlockHash = chain[3].Hash() }, false},
+		{"balance", func(s *StateSnapshot) { s.State.Balances["miner"]++ }, false},
+		{"nonce", func(s *StateSnapshot) { s.State.Nonces["miner"]++ }, false},
+		{"immature reward", func(s *StateSnapshot) { s.State.Immature = s.State.Immature[1:] }, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewStateSnapshot(nil, chain)
+			tt.change(s)
+
+			if equal := s.ComputeHash() == NewStateSnapshot(nil, chain).Hash; equal != tt.wantEqual {
+				t.Errorf("hashes equal = %v, want %v", equal, tt.wantEqual)
+			}
+		})
+	}
+}
+
+func TestVerifySnapshot(t *testing.T) {
+	chain := testBlockchain(4, "miner").Blocks
+	other := testBlockchain(4, "other").Blocks
+	other[0].Timestamp--
+
+	tests := []struct {
+		name       string
+		snapshot   func() *StateSnapshot
+		wantReject bool
+	}{
+		{"trusted snapshot", func() *StateSnapshot {
+			return testServedSnapshot(chain, 3)
+		}, false},
+		{"other chain", func() *StateSnapshot {
+			s := testServedSnapshot(chain, 3)
+			s.ChainID = "suntzuchain-testnet"
+			s.Hash = s.ComputeHash()
+			return s
+		}, true},
+		{"state does not match its hash", func() *StateSnapshot {
+			s := testServedSnapshot(chain, 3)
+			s.State.Balances["miner"]++
+			return s
+		}, true},
+		{"untrusted hash", func() *StateSnapshot {
+			s := testServedSnapshot(chain, 3)
+			s.State.Balances["miner"]++
+			s.Hash = s.ComputeHash()
+			return s
+		}, true},
+		{"missing state", func() *StateSnapshot {
+			s := testServedSnapshot(chain, 3)
+			s.State = nil
+			return s
+		}, true},
+		{"missing headers", func() *StateSnapshot {
+			s := testServedSnapshot(chain, 3)
+			s.Headers = s.Headers[:2]
+			return s
+		}, true},
+		{"headers from another genesis", func() *StateSnapshot {
+			s := testServedSnapshot(chain, 3)
+			s.Headers[0] = other[0].Header()
+			return s
+		}, true},
+		{"invalid header", func() *StateSnapshot {
+			s := testServedSnapshot(chain, 3)
+			s.Headers[2].PrevHash = "0x0"
+			return s
+		}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trustedHash := NewStateSnapshot(nil, chain[:4]).Hash
+
+			blocks, err := verifySnapshot(tt.snapshot(), chain[0], trustedHash)
+			if tt.wantReject {
+				if err == nil {
+					t.Fatal("verifySnapshot() error = nil, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("verifySnapshot() error = %v", err)
+			}
+			testSameBlocks(t, blocks, chain[:4])
+		})
+	}
+}
+
+func TestGetSnapshot(t *testing.T) {
+	bc := testBlockchain(4, "miner")
+	fork := testExtendChain(bc.Blocks[:2], 2, "other")
+
+	tests := []struct {
+		name       string
+		latest     *StateSnapshot
+		wantReject bool
+	}{
+		{"on our chain", NewStateSnapshot(nil, bc.Blocks[:3]), false},
+		{"none yet", nil, true},
+		{"taken on a replaced block", NewStateSnapshot(nil, fork[:3]), true},
+		{"above our tip", NewStateSnapshot(nil, testExtendChain(bc.Blocks, 1, "miner")), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bc.latestSnapshot = tt.latest
+
+			s, err := bc.GetSnapshot()
+			if tt.wantReject {
+				if err == nil {
+					t.Fatal("GetSnapshot() error = nil, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetSnapshot() error = %v", err)
+			}
+			if len(s.Headers) != 3 || s.Headers[2].Hash() != bc.Blocks[2].Hash() {
+				t.Errorf("snapshot headers do not cover blocks 0 to 2")
+			}
+		})
+	}
+}
+
+func TestUpdateSnapshotDropsSnapshotBelowSnapshotHeight(t *testing.T) {
+	bc := testBlockchain(2, "miner")
+	bc.latestSnapshot = NewStateSnapshot(nil, bc.Blocks[:2])
+
+	bc.updateSnapshot()
+
+	if bc.latestSnapshot != nil {
+		t.Errorf("latest snapshot at height %d was kept", bc.latestSnapshot.Height)
+	}
+}
@@ -0,0 +1,149 @@
+package blockchain
+
+import (
+	"github.com/SunTzu71/suntzu_blockchain/constants"
+)
+
+// ChainState holds the spendable account balances, next expected nonces and immature mining
+// rewards obtained by replaying the successful transactions of a chain of blocks from genesis
+type ChainState struct {
+	Balances map[string]uint64 `json:"balances"`
+	Nonces   map[string]uint64 `json:"nonces"`
+	Immature []ImmatureReward  `json:"immature"`
+}
+
+// ImmatureReward is a mining reward that cannot be spent until COINBASE_MATURITY blocks
+// have been built on top of the block that paid it
+type ImmatureReward struct {
+	BlockNumber uint64 `json:"block_number"`
+	Address     string `json:"address"`
+	Value       uint64 `json:"value"`
+}
+
+// NewChainState creates an empty chain state with no balances
+func NewChainState() *ChainState {
+	cs := new(ChainState)
+	cs.Balances = map[string]uint64{}
+	cs.Nonces = map[string]uint64{}
+	cs.Immature = []ImmatureReward{}
+
+	return cs
+}
+
+// NewChainStateFromBlocks creates a chain state by applying every block of the given chain in order
+func NewChainStateFromBlocks(blocks []*Block) *ChainState {
+	cs := NewChainState()
+	for _, block := range blocks {
+		cs.ApplyBlock(block)
+	}
+
+	return cs
+}
+
+// Balance returns the spendable balance of an address in this state
+func (cs *ChainState) Balance(address string) uint64 {
+	return cs.Balances[address]
+}
+
+// ImmatureBalance returns the total of an address's mining rewards that are not spendable yet
+func (cs *ChainState) ImmatureBalance(address string) uint64 {
+	var balance uint64 = 0
+	for _, reward := range cs.Immature {
+		if reward.Address == address {
+			balance += reward.Value
+		}
+	}
+
+	return balance
+}
+
+// NextNonce returns the nonce the next transaction sent by an address must carry
+func (cs *ChainState) NextNonce(address string) uint64 {
+	return cs.Nonces[address]
+}
+
+// ApplyBlock applies all successful transactions of a block to the state without validating them.
+// Rewards that mature at the block's height become spendable first, then the block's transactions
+// are applied. Mining rewards are held as immature without being debited from BLOCKCHAIN_ADDRESS,
+// except for the genesis allocations which are spendable immediately.
+func (cs *ChainState) ApplyBlock(b *Block) {
+	cs.MatureRewards(b.BlockNumber)
+	for _, txn := range b.Transactions {
+		if txn.Status != constants.SUCCESS {
+			continue
+		}
+
+		if txn.From == constants.BLOCKCHAIN_ADDRESS && b.BlockNumber > 0 {
+			cs.addReward(txn, b.BlockNumber)
+		} else {
+			cs.applyTransaction(txn)
+		}
+	}
+}
+
+// MatureRewards moves every immature reward that may be spent by a block at the given height
+// into the spendable balances. A reward paid at block r is spendable from block r+COINBASE_MATURITY.
+// Returns the rewards that matured.
+func (cs *ChainState) MatureRewards(height uint64) []ImmatureReward {
+	immature := []ImmatureReward{}
+	matured := []ImmatureReward{}
+	for _, reward := range cs.Immature {
+		if reward.BlockNumber+constants.COINBASE_MATURITY <= height {
+			cs.Balances[reward.Address] += reward.Value
+			matured = append(matured, reward)
+		} else {
+			immature = append(immature, reward)
+		}
+	}
+
+	cs.Immature = immature
+
+	return matured
+}
+
+// addReward holds the mining reward paid by the block at height until it matures
+func (cs *ChainState) addReward(txn *Transaction, height uint64) {
+	cs.Immature = append(cs.Immature, ImmatureReward{
+		BlockNumber: height,
+		Address:     txn.To,
+		Value:       txn.Value,
+	})
+}
+
+// removeReward drops the most recent immature reward matching the mining reward paid by the block at height
+func (cs *ChainState) removeReward(txn *Transaction, height uint64) {
+	for i := len(cs.Immature) - 1; i >= 0; i-- {
+		reward := cs.Immature[i]
+		if reward.BlockNumber == height && reward.Address == txn.To && reward.Value == txn.Value {
+			cs.Immature = append(cs.Immature[:i:i], cs.Immature[i+1:]...)
+			return
+		}
+	}
+}
+
+// canApply reports whether a transaction is valid on top of this state: it must verify,
+// carry the sender's next nonce and not spend more than the sender's balance
+func (cs *ChainState) canApply(txn *Transaction) bool {
+	return txn.VerifyTransaction() && txn.Nonce == cs.NextNonce(txn.From) && cs.Balance(txn.From) >= txn.Cost()
+}
+
+// applyTransaction moves the value of a single transaction from the sender to the receiver.
+// The fee is debited from the sender and paid to the miner through the block's reward transaction,
+// and the sender's next expected nonce is incremented.
+func (cs *ChainState) applyTransaction(txn *Transaction) {
+	if txn.From != constants.BLOCKCHAIN_ADDRESS {
+		cs.Balances[txn.From] -= txn.Cost()
+		cs.Nonces[txn.From]++
+	}
+	cs.Balances[txn.To] += txn.Value
+}
+
+// revertTransaction undoes applyTransaction, moving the value back to the sender
+// together with the fee and decrementing the sender's next expected nonce
+func (cs *ChainState) revertTransaction(txn *Transaction) {
+	cs.Balances[txn.To] -= txn.Value
+	if txn.From != constants.BLOCKCHAIN_ADDRESS {
+		cs.Balances[txn.From] += txn.Cost()
+		cs.Nonces[txn.From]--
+	}
+}
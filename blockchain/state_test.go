@@ -0,0 +1,89 @@
+package blockchain
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/SunTzu71/suntzu_blockchain/constants"
+)
+
+func TestMatureRewards(t *testing.T) {
+	maturity := constants.COINBASE_MATURITY
+
+	tests := []struct {
+		name          string
+		height        uint64
+		wantSpendable uint64
+		wantImmature  uint64
+	}{
+		{"no reward matured", maturity, 0, 30},
+		{"first reward matured", maturity + 1, 10, 20},
+		{"rewards mature in order", maturity + 2, 30, 0},
+		{"later heights", 10 * maturity, 30, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cs := NewChainState()
+			cs.addReward(&Transaction{To: "miner", Value: 10}, 1)
+			cs.addReward(&Transaction{To: "miner", Value: 20}, 2)
+
+			cs.MatureRewards(tt.height)
+
+			if balance := cs.Balance("miner"); balance != tt.wantSpendable {
+				t.Errorf("spendable balance = %d, want %d", balance, tt.wantSpendable)
+			}
+			if balance := cs.ImmatureBalance("miner"); balance != tt.wantImmature {
+				t.Errorf("immature balance = %d, want %d", balance, tt.wantImmature)
+			}
+		})
+	}
+}
+
+func TestValidateChainEnforcesCoinbaseMaturity(t *testing.T) {
+	maturity := int(constants.COINBASE_MATURITY)
+	miner := newTestKey(t)
+
+	tests := []struct {
+		name       string
+		blocks     int
+		value      uint64
+		wantReject bool
+	}{
+		{"spend of a matured reward", maturity, constants.MINING_REWARD, false},
+		{"spend one block before maturity", maturity - 1, constants.MINING_REWARD, true},
+		{"spend of a reward that is still immature", maturity, constants.MINING_REWARD + 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bc := testBlockchain(tt.blocks, miner.address)
+			block := testMineBlock(bc.Blocks, []*Transaction{miner.transfer(t, "receiver", tt.value, 0, 0)}, "other")
+
+			err := bc.ValidateChain([]*Block{block})
+			if !tt.wantReject {
+				if err != nil {
+					t.Fatalf("ValidateChain() = %v, want nil", err)
+				}
+				return
+			}
+
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("ValidateChain() = %v, want a *ValidationError", err)
+			}
+		})
+	}
+}
+
+func TestValidateChainRejectsOtherCoinbaseMaturity(t *testing.T) {
+	bc := testBlockchain(0, "miner")
+	block := testMineBlock(bc.Blocks, nil, "miner")
+	block.CoinbaseMaturity++
+	testRemine(block)
+
+	var validationErr *ValidationError
+	if err := bc.ValidateChain([]*Block{block}); !errors.As(err, &validationErr) {
+		t.Fatalf("ValidateChain() = %v, want a *ValidationError", err)
+	}
+}
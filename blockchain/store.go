@@ -0,0 +1,36 @@
+package blockchain
+
+// Store persists the state of a BlockchainCore. Implementations must make ConnectBlock and
+// Reorganize atomic, so a crash never leaves a partially written chain behind.
+type Store interface {
+	// Exists reports whether the store holds a blockchain
+	Exists() bool
+
+	// Load reads the stored blocks, transaction pool, peers and address
+	Load() (*BlockchainCore, error)
+
+	// SaveBlockchain writes the whole blockchain core state
+	SaveBlockchain(bc *BlockchainCore) error
+
+	// ConnectBlock writes a block connected on top of the tip together with the updated transaction pool
+	ConnectBlock(b *Block, pool []*Transaction) error
+
+	// Reorganize replaces the blocks from forkIndex up to oldLength-1 with the connected blocks
+	// and writes the updated transaction pool
+	Reorganize(forkIndex uint64, oldLength uint64, connected []*Block, pool []*Transaction) error
+
+	// AddPoolTransaction writes a transaction appended to the transaction pool
+	AddPoolTransaction(txn *Transaction) error
+
+	// SavePeers writes the peers map
+	SavePeers(peers map[string]bool) error
+
+	// LoadBans reads the banned peers, empty if none were saved
+	LoadBans() ([]PeerBan, error)
+
+	// SaveBans writes the banned peers
+	SaveBans(bans []PeerBan) error
+
+	// Close releases the resources held by the store
+	Close() error
+}
@@ -0,0 +1,317 @@
+package blockchain
+
+import (
+	"fmt"
+	"log"
+	"math/big"
+	"sync"
+
+	"github.com/SunTzu71/suntzu_blockchain/constants"
+)
+
+// SyncManager brings our chain up to the peer chain with the most work. Headers are downloaded
+// first from the best peer and checked for proof-of-work, the fork point with our chain is located,
+// then the block bodies after the fork point are fetched in parallel from every peer that has them.
+// Only one sync runs at a time.
+type SyncManager struct {
+	mutex sync.Mutex
+	bc    *BlockchainCore
+}
+
+// syncPeer is a peer with the tip height and total work it reported
+type syncPeer struct {
+	address string
+	height  uint64
+	work    *big.Int
+}
+
+// NewSyncManager creates a sync manager for the given blockchain
+func NewSyncManager(bc *BlockchainCore) *SyncManager {
+	return &SyncManager{bc: bc}
+}
+
+// Sync: syncs our chain with the active peer reporting the most work, see SyncManager.Sync
+func (bc *BlockchainCore) Sync() error {
+	return bc.syncManager.Sync()
+}
+
+// Sync: downloads and connects the chain of the peer with the most work if it has more work than ours.
+// Returns an error if the best peer's chain could not be downloaded, failed validation or could not be
+// stored. Validation failures are also recorded as block rejections.
+func (sm *SyncManager) Sync() error {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	peers := sm.activePeers()
+	best := sm.bestPeer(peers)
+	if best == nil {
+		log.Println("Our chain has the most work, not syncing.")
+		return nil
+	}
+
+	return sm.syncFrom(peers, best)
+}
+
+// SyncPeer: downloads and connects the chain of the peer at the given address if it has more work than ours,
+// fetching every block from that peer
+// Returns an error if the peer is banned, or its chain could not be downloaded or failed validation
+func (sm *SyncManager) SyncPeer(address string) error {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	if sm.bc.IsPeerBanned(address) {
+		return fmt.Errorf("peer %s is banned", address)
+	}
+
+	height, work, err := FetchChainWork(address)
+	if err != nil {
+		sm.bc.penalizeError(address, err)
+		return err
+	}
+
+	peers := []*syncPeer{{address: address, height: height, work: work}}
+	best := sm.bestPeer(peers)
+	if best == nil {
+		return nil
+	}
+
+	return sm.syncFrom(peers, best)
+}
+
+// syncFrom: downloads the headers of the best peer and the blocks after the fork point from the given peers,
+// then reorganizes our chain onto them. Must be called with the sync manager's mutex held.
+func (sm *SyncManager) syncFrom(peers []*syncPeer, best *syncPeer) error {
+	log.Println("Syncing from peer:", best.address, "height:", best.height, "work:", best.work.String())
+
+	forkIndex, headers, err := sm.fetchHeaders(best)
+	if err != nil {
+		sm.bc.recordRejection(best.address, err)
+		return err
+	}
+
+	bodies, err := sm.fetchBodies(peers, best, forkIndex, headers)
+	if err != nil {
+		return err
+	}
+
+	err = sm.bc.ValidateChain(bodies)
+	if err != nil {
+		sm.bc.recordRejection(best.address, err)
+		return err
+	}
+
+	// Stop mining while the blockchain is being replaced
+	sm.bc.MiningLocked.Store(true)
+	replaced, err := sm.bc.UpdateBlockchain(bodies)
+	sm.bc.MiningLocked.Store(false)
+	if err != nil {
+		return err
+	}
+
+	// Another block may have been connected while downloading, leaving our chain with more work
+	if !replaced {
+		return nil
+	}
+
+	blocks := sm.bc.GetBlocks()
+	log.Println("Sync complete! Height:", len(blocks)-1, "Total work:", ChainWork(blocks).String())
+
+	// Let our peers know about the new tip
+	tip := blocks[len(blocks)-1]
+	sm.bc.seenBlocks.add(tip.Hash())
+	go sm.bc.AnnounceBlock(tip)
+
+	// Blocks received before the synced ones may be waiting for the new tip
+	sm.bc.connectOrphans(tip.Hash())
+
+	return nil
+}
+
+// activePeers: returns the tip height and total work reported by every active peer except ourselves and banned peers
+func (sm *SyncManager) activePeers() []*syncPeer {
+	peers := []*syncPeer{}
+	for address, status := range sm.bc.GetPeers() {
+		if address == sm.bc.Address || !status || sm.bc.IsPeerBanned(address) {
+			continue
+		}
+
+		height, work, err := FetchChainWork(address)
+		if err != nil {
+			log.Println("Error while fetching chain work from peer:", address, "Error:", err.Error())
+			sm.bc.penalizeError(address, err)
+			continue
+		}
+
+		peers = append(peers, &syncPeer{address: address, height: height, work: work})
+	}
+
+	return peers
+}
+
+// bestPeer: returns the peer reporting the most work, or nil if no peer has more work than us
+func (sm *SyncManager) bestPeer(peers []*syncPeer) *syncPeer {
+	var best *syncPeer
+	bestWork := sm.bc.TotalWork()
+	for _, peer := range peers {
+		if peer.work.Cmp(bestWork) > 0 {
+			best = peer
+			bestWork = peer.work
+		}
+	}
+
+	return best
+}
+
+// fetchHeaders: downloads the headers of the best peer's chain after the last block we share with it.
+// The peer locates the fork point from our block locator, see FindFork. The headers are checked with
+// validateHeader on top of our blocks up to the fork point and must add up to more work than our chain.
+// Returns the index of the first block that differs from ours and the headers from that index to the peer's tip.
+func (sm *SyncManager) fetchHeaders(peer *syncPeer) (uint64, []BlockHeader, error) {
+	blocks := sm.bc.GetBlocks()
+
+	fork, err := FetchFork(peer.address, sm.bc.BlockLocator())
+	if err != nil {
+		return 0, nil, err
+	}
+	if fork.BlockNumber >= uint64(len(blocks)) || blocks[fork.BlockNumber].Hash() != fork.BlockHash {
+		return 0, nil, fmt.Errorf("peer %s located fork point %s that is not part of our chain", peer.address, fork.BlockHash)
+	}
+
+	// Download the headers after the fork point up to the peer's tip
+	headers := []BlockHeader{}
+	next := fork.BlockNumber + 1
+	for next <= peer.height {
+		fetched, err := FetchHeaderRange(peer.address, next, constants.FETCH_HEADER_NUMBER)
+		if err != nil {
+			return 0, nil, err
+		}
+		if len(fetched) == 0 || fetched[0].BlockNumber != next {
+			return 0, nil, fmt.Errorf("peer %s returned no header at height %d", peer.address, next)
+		}
+		headers = append(headers, fetched...)
+		next += uint64(len(fetched))
+	}
+
+	// The headers must match the hashes the peer located, otherwise its chain changed in between
+	for i, hash := range fork.Hashes {
+		if i < len(headers) && headers[i].Hash() != hash {
+			return 0, nil, fmt.Errorf("peer %s returned header %d not matching the located hashes", peer.address, headers[i].BlockNumber)
+		}
+	}
+
+	// The locator skips blocks further from our tip, so skip the headers after the fork point we already have
+	forkIndex := fork.BlockNumber + 1
+	for len(headers) > 0 && forkIndex < uint64(len(blocks)) && headers[0].Hash() == blocks[forkIndex].Hash() {
+		headers = headers[1:]
+		forkIndex++
+	}
+	if len(headers) == 0 {
+		return 0, nil, fmt.Errorf("peer %s has no blocks after ours", peer.address)
+	}
+
+	if sm.bc.BaseSnapshot != nil && forkIndex <= sm.bc.BaseSnapshot.Height {
+		return 0, nil, fmt.Errorf("peer %s forks below our snapshot height %d", peer.address, sm.bc.BaseSnapshot.Height)
+	}
+
+	chain := append([]*Block{}, blocks[:forkIndex]...)
+	for _, header := range headers {
+		block := headerBlock(header)
+		err = validateHeader(chain, block)
+		if err != nil {
+			return 0, nil, err
+		}
+		chain = append(chain, block)
+	}
+
+	if ChainWork(chain).Cmp(sm.bc.TotalWork()) <= 0 {
+		return 0, nil, fmt.Errorf("headers of peer %s do not have more work than our chain", peer.address)
+	}
+
+	log.Println("Downloaded headers from peer:", peer.address, "fork height:", forkIndex-1, "new headers:", len(headers))
+
+	return forkIndex, headers, nil
+}
+
+// fetchBodies: downloads the blocks matching the given headers, starting at forkIndex, in ranges of
+// FETCH_BLOCK_NUMBER blocks. SYNC_WORKERS ranges are fetched at once, each from a different peer
+// reporting a tip at or beyond the end of the range. A range whose blocks do not match the headers
+// is retried with the next peer, falling back to the peer the headers came from.
+func (sm *SyncManager) fetchBodies(peers []*syncPeer, best *syncPeer, forkIndex uint64, headers []BlockHeader) ([]*Block, error) {
+	bodies := make([]*Block, len(headers))
+	ranges := make(chan int)
+	errs := make(chan error, len(headers)/constants.FETCH_BLOCK_NUMBER+1)
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < constants.SYNC_WORKERS; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for offset := range ranges {
+				err := sm.fetchRange(peers, best, forkIndex, headers, bodies, offset)
+				if err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+
+	for offset := 0; offset < len(headers); offset += constants.FETCH_BLOCK_NUMBER {
+		ranges <- offset
+	}
+	close(ranges)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		return nil, err
+	}
+
+	return bodies, nil
+}
+
+// fetchRange: fetches the blocks for headers[offset:offset+FETCH_BLOCK_NUMBER] into bodies, trying
+// every peer that reported a tip high enough, starting with a different peer for each range.
+// Peers that advertised a snapshot height at or above the start of the range in their handshake do not
+// store its blocks and are skipped. Peers whose request fails are penalized.
+func (sm *SyncManager) fetchRange(peers []*syncPeer, best *syncPeer, forkIndex uint64, headers []BlockHeader, bodies []*Block, offset int) error {
+	end := min(offset+constants.FETCH_BLOCK_NUMBER, len(headers))
+	from := forkIndex + uint64(offset)
+	last := forkIndex + uint64(end-1)
+
+	candidates := []*syncPeer{}
+	for _, peer := range peers {
+		if peer != best && peer.height >= last && sm.bc.peerBook.snapshotHeight(peer.address) < from {
+			candidates = append(candidates, peer)
+		}
+	}
+	// Spread the ranges over the peers, keeping the peer the headers came from as the last resort
+	rotation := (offset / constants.FETCH_BLOCK_NUMBER) % (len(candidates) + 1)
+	candidates = append(candidates[rotation:], candidates[:rotation]...)
+	if sm.bc.peerBook.snapshotHeight(best.address) < from {
+		candidates = append(candidates, best)
+	}
+
+	lastErr := fmt.Errorf("no peer stores the blocks from height %d", from)
+	for _, peer := range candidates {
+		blocks, err := FetchBlockRange(peer.address, from, end-offset)
+		if err == nil && len(blocks) != end-offset {
+			err = fmt.Errorf("peer %s returned %d blocks from height %d, expected %d", peer.address, len(blocks), from, end-offset)
+		}
+		for i := 0; err == nil && i < len(blocks); i++ {
+			if blocks[i].Hash() != headers[offset+i].Hash() {
+				err = fmt.Errorf("peer %s returned block %d not matching the synced headers", peer.address, from+uint64(i))
+			}
+		}
+		if err != nil {
+			log.Println("Error while fetching blocks from peer:", peer.address, "Error:", err.Error())
+			sm.bc.penalizeError(peer.address, err)
+			lastErr = err
+			continue
+		}
+
+		copy(bodies[offset:end], blocks)
+		return nil
+	}
+
+	return lastErr
+}
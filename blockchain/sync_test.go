@@ -0,0 +1,75 @@
+package blockchain
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/SunTzu71/suntzu_blockchain/constants"
+)
+
+func TestBestPeer(t *testing.T) {
+	bc := testBlockchain(2, "miner")
+	sm := NewSyncManager(bc)
+	ours := bc.TotalWork().Int64()
+
+	tests := []struct {
+		name  string
+		works []int64
+		want  int
+	}{
+		{"no peers", []int64{}, -1},
+		{"less work", []int64{ours - 1}, -1},
+		{"equal work", []int64{ours}, -1},
+		{"more work", []int64{ours + 1}, 0},
+		{"most work wins", []int64{ours + 1, ours + 5, ours + 3}, 1},
+		{"first of equals", []int64{ours + 2, ours + 2}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			peers := []*syncPeer{}
+			for _, work := range tt.works {
+				peers = append(peers, &syncPeer{address: "peer", work: big.NewInt(work)})
+			}
+
+			best := sm.bestPeer(peers)
+			if tt.want < 0 {
+				if best != nil {
+					t.Errorf("bestPeer() = %v, want nil", best)
+				}
+				return
+			}
+			if best != peers[tt.want] {
+				t.Errorf("bestPeer() = %v, want peer %d", best, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtendsOurChain(t *testing.T) {
+	bc := testBlockchain(3, "ours")
+	fork := testExtendChain(bc.Blocks[:2], 3, "theirs")
+	genesis := NewBlock("0x0", 0, 0, constants.MIN_MINING_DIFFICULTY)
+	genesis.Timestamp--
+
+	tests := []struct {
+		name  string
+		chain []*Block
+		want  bool
+	}{
+		{"whole chain from our genesis", fork, true},
+		{"fork after a shared block", fork[2:], true},
+		{"blocks after our tip", testExtendChain(bc.Blocks, 2, "theirs")[4:], true},
+		{"other genesis", testExtendChain([]*Block{genesis}, 2, "theirs"), false},
+		{"parent not on our chain", fork[3:], false},
+		{"gap after our tip", testExtendChain(bc.Blocks, 2, "theirs")[5:], false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := bc.extendsOurChain(tt.chain); got != tt.want {
+				t.Errorf("extendsOurChain() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package blockchain
+
+import (
+	"math/bits"
+	"sort"
+	"strconv"
+
+	"github.com/SunTzu71/suntzu_blockchain/constants"
+)
+
+// selectTransactions: picks transactions from the pool for the next block by fee rate (fee per byte of Size).
+// Transactions from the same sender must stay in nonce order, so at each step the best fee rate among the
+// next transaction of every sender is taken, with ties kept in pool order. When a sender's next transaction
+// does not fit within sizeLimit the rest of that sender's transactions are skipped. Failed transactions are
+// never mined. Returns copies of the selected transactions so the pool is never modified by mining.
+func selectTransactions(pool []*Transaction, sizeLimit int) []*Transaction {
+	senders := []string{}
+	queues := map[string][]*Transaction{}
+	for _, txn := range pool {
+		if txn.Status != constants.TRANSACTION_VERIFY_SUCCESS {
+			continue
+		}
+
+		if _, ok := queues[txn.From]; !ok {
+			senders = append(senders, txn.From)
+		}
+		queues[txn.From] = append(queues[txn.From], txn)
+	}
+
+	for _, sender := range senders {
+		queue := queues[sender]
+		sort.SliceStable(queue, func(i, j int) bool {
+			return queue[i].Nonce < queue[j].Nonce
+		})
+	}
+
+	selected := []*Transaction{}
+	blockSize := 0
+	for {
+		var best *Transaction
+		for _, sender := range senders {
+			queue := queues[sender]
+			if len(queue) == 0 {
+				continue
+			}
+			if best == nil || higherFeeRate(queue[0], best) {
+				best = queue[0]
+			}
+		}
+
+		if best == nil {
+			break
+		}
+
+		if blockSize+best.Size() > sizeLimit {
+			queues[best.From] = nil
+			continue
+		}
+
+		newTxn := *best
+		selected = append(selected, &newTxn)
+		blockSize += best.Size()
+		queues[best.From] = queues[best.From][1:]
+	}
+
+	return selected
+}
+
+// higherFeeRate: reports whether a pays a higher fee per byte than b. Fee rates are compared by cross
+// multiplying to avoid floating point rounding, with 128 bit products so large fees cannot overflow.
+func higherFeeRate(a *Transaction, b *Transaction) bool {
+	aHi, aLo := bits.Mul64(a.Fee, uint64(b.Size()))
+	bHi, bLo := bits.Mul64(b.Fee, uint64(a.Size()))
+
+	return aHi > bHi || (aHi == bHi && aLo > bLo)
+}
+
+// NewBlockTemplate: assembles the next block to mine on top of our tip. Transactions are selected
+// from the pool by fee rate up to BLOCK_SIZE_LIMIT, leaving room for the reward transaction, which
+// pays the BlockReward for the height plus the fees of the selected transactions to the miner's address.
+// The Merkle root is calculated so only the nonce remains to be found.
+func (bc *BlockchainCore) NewBlockTemplate(minersAddress string, nonce int64) *Block {
+	bc.mutex.Lock()
+	defer bc.mutex.Unlock()
+
+	prevHash := bc.Blocks[len(bc.Blocks)-1].Hash()
+	difficulty := NextDifficulty(bc.Blocks)
+
+	block := NewBlock(prevHash, nonce, uint64(len(bc.Blocks)), difficulty)
+	block.Timestamp = max(block.Timestamp, MedianTimePast(bc.Blocks)+1)
+	reward := BlockReward(block.BlockNumber, GenesisSupply(bc.Blocks[0]))
+
+	// The block number is placed in the reward data so rewards mined in the same second have unique hashes
+	rewardData := []byte(strconv.FormatUint(block.BlockNumber, 10))
+	rewardTxn := NewTransaction(constants.BLOCKCHAIN_ADDRESS, minersAddress, reward, 0, 0, rewardData)
+	rewardTxn.Status = constants.SUCCESS
+
+	sizeLimit := min(constants.BLOCK_SIZE_LIMIT, constants.MAX_BLOCK_SIZE) - rewardTxn.Size()
+
+	var fees uint64 = 0
+	for _, txn := range selectTransactions(bc.TransactionPool, sizeLimit) {
+		block.AddTransactionToTheBlock(txn)
+		fees += txn.Fee
+	}
+
+	// The value is encoded with a fixed width, so adding the fees does not change the reward's size
+	rewardTxn = NewTransaction(constants.BLOCKCHAIN_ADDRESS, minersAddress, reward+fees, 0, 0, rewardData)
+	rewardTxn.Status = constants.SUCCESS
+	block.Transactions = append(block.Transactions, rewardTxn)
+	block.MerkleRoot = block.CalculateMerkleRoot()
+
+	return block
+}
@@ -0,0 +1,112 @@
+package blockchain
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/SunTzu71/suntzu_blockchain/constants"
+)
+
+// testPoolTransaction returns a verified pool transaction from sender with the given fee, nonce and data
+func testPoolTransaction(from string, fee uint64, nonce uint64, data string) *Transaction {
+	txn := NewTransaction(from, "receiver", 1, fee, nonce, []byte(data))
+	txn.Status = constants.TRANSACTION_VERIFY_SUCCESS
+
+	return txn
+}
+
+func TestSelectTransactions(t *testing.T) {
+	size := testPoolTransaction("a", 0, 0, "").Size()
+	failed := testPoolTransaction("c", 100, 0, "")
+	failed.Status = constants.FAILED
+
+	tests := []struct {
+		name      string
+		pool      []*Transaction
+		sizeLimit int
+		want      []string
+	}{
+		{"highest fee rate first", []*Transaction{
+			testPoolTransaction("a", 1, 0, ""),
+			testPoolTransaction("b", 3, 0, ""),
+			testPoolTransaction("c", 2, 0, ""),
+		}, 10 * size, []string{"b:0", "c:0", "a:0"}},
+		{"fee rate is per byte", []*Transaction{
+			testPoolTransaction("a", 3, 0, string(make([]byte, 4*size))),
+			testPoolTransaction("b", 1, 0, ""),
+		}, 10 * size, []string{"b:0", "a:0"}},
+		{"nonce order within a sender", []*Transaction{
+			testPoolTransaction("a", 10, 1, ""),
+			testPoolTransaction("a", 1, 0, ""),
+			testPoolTransaction("b", 5, 0, ""),
+		}, 10 * size, []string{"b:0", "a:0", "a:1"}},
+		{"ties keep pool order", []*Transaction{
+			testPoolTransaction("b", 2, 0, ""),
+			testPoolTransaction("a", 2, 0, ""),
+		}, 10 * size, []string{"b:0", "a:0"}},
+		{"failed transactions are skipped", []*Transaction{
+			testPoolTransaction("a", 1, 0, ""),
+			failed,
+		}, 10 * size, []string{"a:0"}},
+		{"size limit", []*Transaction{
+			testPoolTransaction("a", 1, 0, ""),
+			testPoolTransaction("b", 3, 0, ""),
+			testPoolTransaction("c", 2, 0, ""),
+		}, 2 * size, []string{"b:0", "c:0"}},
+		{"sender that does not fit is skipped", []*Transaction{
+			testPoolTransaction("a", 1000, 0, string(make([]byte, size))),
+			testPoolTransaction("a", 1000, 1, ""),
+			testPoolTransaction("b", 1, 0, ""),
+		}, size + 1, []string{"b:0"}},
+		{"empty pool", []*Transaction{}, 10 * size, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []string{}
+			for _, txn := range selectTransactions(tt.pool, tt.sizeLimit) {
+				got = append(got, fmt.Sprintf("%s:%d", txn.From, txn.Nonce))
+			}
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("selectTransactions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectTransactionsCopiesThePool(t *testing.T) {
+	pool := []*Transaction{testPoolTransaction("a", 1, 0, "")}
+
+	selectTransactions(pool, math.MaxInt)[0].Status = constants.SUCCESS
+
+	if pool[0].Status != constants.TRANSACTION_VERIFY_SUCCESS {
+		t.Errorf("pool transaction status = %q, want %q", pool[0].Status, constants.TRANSACTION_VERIFY_SUCCESS)
+	}
+}
+
+func TestHigherFeeRate(t *testing.T) {
+	small := testPoolTransaction("a", 0, 0, "").Size()
+
+	tests := []struct {
+		name string
+		a, b *Transaction
+		want bool
+	}{
+		{"higher fee", testPoolTransaction("a", 2, 0, ""), testPoolTransaction("b", 1, 0, ""), true},
+		{"lower fee", testPoolTransaction("a", 1, 0, ""), testPoolTransaction("b", 2, 0, ""), false},
+		{"equal rate", testPoolTransaction("a", 2, 0, string(make([]byte, small))), testPoolTransaction("b", 1, 0, ""), false},
+		{"largest fees do not overflow", testPoolTransaction("a", math.MaxUint64, 0, ""), testPoolTransaction("b", math.MaxUint64-1, 0, ""), true},
+		{"largest fee on a larger transaction", testPoolTransaction("a", math.MaxUint64, 0, string(make([]byte, small))), testPoolTransaction("b", math.MaxUint64-1, 0, ""), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := higherFeeRate(tt.a, tt.b); got != tt.want {
+				t.Errorf("higherFeeRate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package blockchain
+
+import (
+	"sort"
+	"time"
+
+	"github.com/SunTzu71/suntzu_blockchain/constants"
+)
+
+// MedianTimePast: returns the median timestamp of the last MEDIAN_TIME_BLOCKS blocks of the chain,
+// or of all its blocks when the chain is shorter. A new block must be stamped later than this value,
+// so a single miner with a wrong clock cannot move the chain's time backwards.
+func MedianTimePast(chain []*Block) int64 {
+	start := max(len(chain)-constants.MEDIAN_TIME_BLOCKS, 0)
+
+	timestamps := []int64{}
+	for _, block := range chain[start:] {
+		timestamps = append(timestamps, block.Timestamp)
+	}
+	sort.Slice(timestamps, func(i, j int) bool {
+		return timestamps[i] < timestamps[j]
+	})
+
+	return timestamps[len(timestamps)/2]
+}
+
+// validateTimestamp: checks that a block is stamped after the median time past of the chain
+// preceding it and no more than MAX_FUTURE_BLOCK_TIME seconds ahead of our clock
+func validateTimestamp(prevChain []*Block, b *Block) error {
+	medianTime := MedianTimePast(prevChain)
+	if b.Timestamp <= medianTime {
+		return newValidationError(b, "timestamp %d is not after median time past %d", b.Timestamp, medianTime)
+	}
+
+	maxTime := time.Now().Unix() + constants.MAX_FUTURE_BLOCK_TIME
+	if b.Timestamp > maxTime {
+		// Our clock may be the one that is off, so the block can become valid later
+		err := newValidationError(b, "timestamp %d is more than %d seconds in the future", b.Timestamp, constants.MAX_FUTURE_BLOCK_TIME)
+		err.temporary = true
+		return err
+	}
+
+	return nil
+}
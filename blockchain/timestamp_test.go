@@ -0,0 +1,85 @@
+package blockchain
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/SunTzu71/suntzu_blockchain/constants"
+)
+
+// testStampedChain returns a chain of blocks stamped with the given timestamps
+func testStampedChain(timestamps ...int64) []*Block {
+	chain := []*Block{}
+	for i, timestamp := range timestamps {
+		block := NewBlock("0x0", 0, uint64(i), 1)
+		block.Timestamp = timestamp
+		chain = append(chain, block)
+	}
+
+	return chain
+}
+
+func TestMedianTimePast(t *testing.T) {
+	tests := []struct {
+		name  string
+		chain []*Block
+		want  int64
+	}{
+		{"genesis only", testStampedChain(5), 5},
+		{"unordered timestamps", testStampedChain(1, 9, 3), 3},
+		{"even length takes the upper median", testStampedChain(1, 2, 3, 4), 3},
+		{"only the last blocks count", testStampedChain(100, 100, 100, 100, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11), 6},
+		{"one late clock cannot move it", testStampedChain(1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 1000), 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MedianTimePast(tt.chain); got != tt.want {
+				t.Errorf("MedianTimePast() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateTimestamp(t *testing.T) {
+	now := time.Now().Unix()
+	chain := testStampedChain(now-50, now-40, now-30)
+
+	tests := []struct {
+		name          string
+		timestamp     int64
+		wantReject    bool
+		wantTemporary bool
+	}{
+		{"after the median", now - 39, false, false},
+		{"now", now, false, false},
+		{"at the median", now - 40, true, false},
+		{"before the median", now - 100, true, false},
+		{"within the future limit", now + constants.MAX_FUTURE_BLOCK_TIME - 5, false, false},
+		{"too far in the future", now + constants.MAX_FUTURE_BLOCK_TIME + 5, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			block := NewBlock("0x0", 0, uint64(len(chain)), 1)
+			block.Timestamp = tt.timestamp
+
+			err := validateTimestamp(chain, block)
+			if !tt.wantReject {
+				if err != nil {
+					t.Fatalf("validateTimestamp() = %v, want nil", err)
+				}
+				return
+			}
+
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("validateTimestamp() = %v, want a *ValidationError", err)
+			}
+			if validationErr.temporary != tt.wantTemporary {
+				t.Errorf("temporary = %v, want %v", validationErr.temporary, tt.wantTemporary)
+			}
+		})
+	}
+}
@@ -14,9 +14,12 @@ import (
 )
 
 type Transaction struct {
+	ChainID         string `json:"chain_id"`
 	From            string `json:"from"`
 	To              string `json:"to"`
 	Value           uint64 `json:"value"`
+	Fee             uint64 `json:"fee"`
+	Nonce           uint64 `json:"nonce"`
 	Data            []byte `json:"data"`
 	Status          string `json:"status"`
 	Timestamp       uint64 `json:"timestamp"`
@@ -25,13 +28,16 @@ type Transaction struct {
 	Signature       []byte `json:"Signature"`
 }
 
-// NewTransaction creates and returns a new Transaction object initialized with the provided parameters
-// and default values for Status, PublicKey, and Signature fields
-func NewTransaction(from string, to string, value uint64, data []byte) *Transaction {
+// NewTransaction creates and returns a new Transaction object for the configured chain ID, initialized
+// with the provided parameters and default values for Status, PublicKey, and Signature fields
+func NewTransaction(from string, to string, value uint64, fee uint64, nonce uint64, data []byte) *Transaction {
 	t := new(Transaction)
+	t.ChainID = constants.CHAIN_ID
 	t.From = from
 	t.To = to
 	t.Value = value
+	t.Fee = fee
+	t.Nonce = nonce
 	t.Data = data
 	t.Status = constants.PENDING
 	t.Timestamp = uint64(time.Now().Unix())
@@ -51,17 +57,24 @@ func (t Transaction) ToJson() string {
 }
 
 // VerifyTransaction checks if the transaction is valid by verifying:
+// 0. The transaction was created for our chain ID
 // 1. The value is not zero
-// 2. The value does not exceed maximum uint64
+// 2. The value plus fee does not exceed maximum uint64
 // 3. The sender and receiver addresses are not the same
-// 4. The signature is valid
+// 4. The transaction hash matches its contents
+// 5. The public key is a well-formed hex encoded key and the sender address belongs to it
+// 6. The signature is valid
 // Returns true if all checks pass, false otherwise
 func (t Transaction) VerifyTransaction() bool {
+	if t.ChainID != constants.CHAIN_ID {
+		return false
+	}
+
 	if t.Value <= 0 {
 		return false
 	}
 
-	if t.Value > math.MaxUint64 {
+	if t.Value > math.MaxUint64-t.Fee {
 		return false
 	}
 
@@ -69,6 +82,14 @@ func (t Transaction) VerifyTransaction() bool {
 		return false
 	}
 
+	if t.TransactionHash != t.Hash() {
+		return false
+	}
+
+	if !IsPublicKeyHex(t.PublicKey) || GetAddressFromPublicKeyHex(t.PublicKey) != t.From {
+		return false
+	}
+
 	valid := t.VeryifySignature()
 	if !valid {
 		return false
@@ -79,44 +100,65 @@ func (t Transaction) VerifyTransaction() bool {
 
 // VeryifySignature verifies the digital signature of a transaction using ECDSA
 // It first checks if signature and public key exist, then verifies the signature
-// against the transaction hash using the public key.
+// against the transaction's signing hash using the public key.
 // Returns true if signature is valid, false otherwise
 func (t Transaction) VeryifySignature() bool {
-	if t.Signature == nil || t.PublicKey == "" {
+	if t.Signature == nil {
 		return false
 	}
 
-	signature := t.Signature
-	publicKeyHex := t.PublicKey
-	t.Signature = []byte{}
-	t.PublicKey = ""
-	publicKeyEcdsa := GetPublicKeyFromHex(publicKeyHex)
+	publicKeyEcdsa := GetPublicKeyFromHex(t.PublicKey)
+	if publicKeyEcdsa == nil {
+		return false
+	}
+	hash := t.SigningHash()
 
-	bs, _ := json.Marshal(t)
-	hash := sha256.Sum256(bs)
+	return ecdsa.VerifyASN1(publicKeyEcdsa, hash[:], t.Signature)
+}
 
-	valid := ecdsa.VerifyASN1(publicKeyEcdsa, hash[:], signature)
-	t.Signature = signature
+// Cost returns the total amount debited from the sender: the value plus the fee
+func (t Transaction) Cost() uint64 {
+	return t.Value + t.Fee
+}
 
-	return valid
+// Size returns the number of bytes the transaction takes up in a block:
+// its signing payload plus the signature and public key
+func (t Transaction) Size() int {
+	return len(t.SigningPayload()) + len(t.Signature) + len(t.PublicKey)
 }
 
-// Hash generates a SHA-256 hash of the transaction data and returns it as a hex string with prefix.
-// The transaction is first marshaled to JSON, then hashed, and finally encoded to a hex string.
+// Hash returns the signing hash of the transaction as a hex string with prefix.
+// Only the fields of the canonical signing payload are covered, so the hash does not
+// change when a node updates the transaction's status.
 func (t Transaction) Hash() string {
-	bs, _ := json.Marshal(t)
-	sum := sha256.Sum256(bs)
-	hexRep := hex.EncodeToString(sum[:32])
+	hash := t.SigningHash()
+	hexRep := hex.EncodeToString(hash[:])
 	formattedHexRep := constants.HEX_PREFIX + hexRep
 
 	return formattedHexRep
 }
 
+// IsPublicKeyHex reports whether a string is a hex encoded public key: the hex prefix followed by
+// the 64 hex characters of each of the x and y coordinates
+func IsPublicKeyHex(publicKeyHex string) bool {
+	if len(publicKeyHex) != len(constants.HEX_PREFIX)+128 || publicKeyHex[:len(constants.HEX_PREFIX)] != constants.HEX_PREFIX {
+		return false
+	}
+
+	_, err := hex.DecodeString(publicKeyHex[len(constants.HEX_PREFIX):])
+	return err == nil
+}
+
 // GetPublicKeyFromHex converts a hex string representation of a public key to an ECDSA public key
-// It strips the hex prefix, splits the remaining string into x and y coordinates,
+// It strips the hex prefix, splits the remaining string into 64 character x and y coordinates,
 // and creates a new public key using the P256 curve
+// Returns nil if the string is not a hex encoded public key, see IsPublicKeyHex
 func GetPublicKeyFromHex(publicKeyHex string) *ecdsa.PublicKey {
-	rpk := publicKeyHex[2:]
+	if !IsPublicKeyHex(publicKeyHex) {
+		return nil
+	}
+
+	rpk := publicKeyHex[len(constants.HEX_PREFIX):]
 	xHex := rpk[0:64]
 	yHex := rpk[64:]
 	x := new(big.Int)
@@ -131,3 +173,19 @@ func GetPublicKeyFromHex(publicKeyHex string) *ecdsa.PublicKey {
 
 	return &npk
 }
+
+// GetAddressFromPublicKeyHex derives the blockchain address owning a hex encoded public key by:
+// 1. Taking the public key (without "0x" prefix)
+// 2. Computing its SHA256 hash
+// 3. Converting hash to hex string
+// 4. Taking last 40 chars and prepending ADDRESS_PREFIX
+// Returns an empty string if the string is not a hex encoded public key, see IsPublicKeyHex
+func GetAddressFromPublicKeyHex(publicKeyHex string) string {
+	if !IsPublicKeyHex(publicKeyHex) {
+		return ""
+	}
+
+	hash := sha256.Sum256([]byte(publicKeyHex[len(constants.HEX_PREFIX):]))
+	hexRep := hex.EncodeToString(hash[:])
+	return constants.ADDRESS_PREFIX + hexRep[len(hexRep)-40:]
+}
@@ -0,0 +1,63 @@
+package blockchain
+
+import (
+	"math"
+	"testing"
+)
+
+func TestVerifyTransaction(t *testing.T) {
+	sender := newTestKey(t)
+	other := newTestKey(t)
+
+	tests := []struct {
+		name string
+		txn  func() *Transaction
+		want bool
+	}{
+		{"signed transfer", func() *Transaction {
+			return sender.transfer(t, "receiver", 100, 1, 0)
+		}, true},
+		{"signed for another chain", func() *Transaction {
+			txn := NewTransaction(sender.address, "receiver", 100, 1, 0, []byte{})
+			txn.ChainID = "suntzuchain-testnet"
+			return sender.sign(t, txn)
+		}, false},
+		{"zero value", func() *Transaction {
+			return sender.transfer(t, "receiver", 0, 1, 0)
+		}, false},
+		{"value plus fee overflows", func() *Transaction {
+			return sender.transfer(t, "receiver", math.MaxUint64, 1, 0)
+		}, false},
+		{"sent to itself", func() *Transaction {
+			return sender.transfer(t, sender.address, 100, 1, 0)
+		}, false},
+		{"hash does not match", func() *Transaction {
+			txn := sender.transfer(t, "receiver", 100, 1, 0)
+			txn.TransactionHash = "0x0"
+			return txn
+		}, false},
+		{"public key of another address", func() *Transaction {
+			txn := sender.transfer(t, "receiver", 100, 1, 0)
+			txn.PublicKey = other.publicKey
+			return txn
+		}, false},
+		{"malformed public key", func() *Transaction {
+			txn := sender.transfer(t, "receiver", 100, 1, 0)
+			txn.PublicKey = "0xabc"
+			return txn
+		}, false},
+		{"missing signature", func() *Transaction {
+			txn := sender.transfer(t, "receiver", 100, 1, 0)
+			txn.Signature = nil
+			return txn
+		}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.txn().VerifyTransaction(); got != tt.want {
+				t.Errorf("VerifyTransaction() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
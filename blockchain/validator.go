@@ -0,0 +1,370 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/SunTzu71/suntzu_blockchain/constants"
+)
+
+// ValidationError describes why a block was rejected by ValidateChain.
+// A temporary rejection, such as a timestamp ahead of our clock, may not hold once time has passed.
+type ValidationError struct {
+	BlockNumber uint64 `json:"block_number"`
+	BlockHash   string `json:"block_hash"`
+	Reason      string `json:"reason"`
+	temporary   bool
+}
+
+// Error returns a human readable description of the validation failure
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("block %d (%s) rejected: %s", e.BlockNumber, e.BlockHash, e.Reason)
+}
+
+// newValidationError creates a ValidationError for the given block with a formatted reason
+func newValidationError(b *Block, format string, args ...any) *ValidationError {
+	return &ValidationError{
+		BlockNumber: b.BlockNumber,
+		BlockHash:   b.Hash(),
+		Reason:      fmt.Sprintf(format, args...),
+	}
+}
+
+// BlockRejection records a chain received from a peer that failed validation
+type BlockRejection struct {
+	Peer        string `json:"peer"`
+	BlockNumber uint64 `json:"block_number"`
+	BlockHash   string `json:"block_hash"`
+	Reason      string `json:"reason"`
+	Timestamp   int64  `json:"timestamp"`
+}
+
+// ValidateChain: validates a chain of blocks fetched from a peer against our local state.
+// The fetched blocks are placed after our own blocks preceding them, then every fetched block is checked for:
+// 1. Correct block numbering and previous hash links
+// 2. A timestamp after the median of the previous MEDIAN_TIME_BLOCKS and not too far in the future
+// 3. The difficulty dictated by NextDifficulty and a hash meeting that difficulty
+// 4. A Merkle root matching the block's transactions
+// 5. No transaction hash that already appears earlier in the chain
+// 6. Exactly one coinbase transaction paying the BlockReward for its height plus the block's fees
+// 7. A successful status, valid signature, sender nonce and sufficient spendable balance for every transaction, replayed in order
+// 8. A total transaction size within MAX_BLOCK_SIZE
+// A chain extending our tip is validated against the balances and nonces of the chain index, while a chain
+// replacing some of our blocks has the state replayed up to the fork point.
+// Returns a *ValidationError describing the first invalid block, an error if the chain holds no blocks,
+// or nil if the chain is valid.
+func (bc *BlockchainCore) ValidateChain(chain []*Block) error {
+	if len(chain) == 0 {
+		return errors.New("chain holds no blocks")
+	}
+
+	bc.mutex.Lock()
+	blocks := bc.Blocks
+	var validator *chainValidator
+	if chain[0].BlockNumber == uint64(len(blocks)) {
+		validator = newTipValidator(blocks, bc.index)
+	}
+	bc.mutex.Unlock()
+
+	if validator != nil {
+		return validator.connectChain(chain)
+	}
+
+	initIndex := chain[0].BlockNumber
+	if initIndex > uint64(len(blocks)) {
+		return newValidationError(chain[0], "chain starts beyond our height %d", len(blocks)-1)
+	}
+
+	// Blocks up to the height of the snapshot we started from are trusted and must match ours
+	base := bc.BaseSnapshot
+	if base != nil {
+		for len(chain) > 0 && chain[0].BlockNumber <= base.Height {
+			if chain[0].Hash() != blocks[chain[0].BlockNumber].Hash() {
+				return newValidationError(chain[0], "block conflicts with the snapshot at height %d", base.Height)
+			}
+			chain = chain[1:]
+		}
+		if len(chain) == 0 {
+			return nil
+		}
+		initIndex = chain[0].BlockNumber
+	}
+
+	validator = newChainValidator(blocks[0], base, blocks[:initIndex])
+
+	return validator.connectChain(chain)
+}
+
+// chainValidator validates blocks one at a time on top of a chain, keeping the replayed state
+// and the hashes of the transactions seen so far. When index is not nil, the transactions of
+// the blocks it had indexed when the validator was created are looked up there instead.
+type chainValidator struct {
+	genesis       *Block
+	chain         []*Block
+	state         *ChainState
+	seenTxns      map[string]bool
+	index         *ChainIndex
+	genesisSupply uint64
+}
+
+// newChainValidator: creates a validator for blocks following prefix, which must be already validated
+// blocks starting at our genesis block. Blocks numbered 0 must match genesis. When base is not nil,
+// prefix must extend past the snapshot's height and the state is replayed from the snapshot.
+func newChainValidator(genesis *Block, base *StateSnapshot, prefix []*Block) *chainValidator {
+	v := new(chainValidator)
+	v.genesis = genesis
+	v.chain = append([]*Block{}, prefix...)
+	v.state = replayState(base, prefix)
+	v.genesisSupply = GenesisSupply(genesis)
+	v.seenTxns = map[string]bool{}
+	for _, block := range prefix {
+		for _, txn := range block.Transactions {
+			v.seenTxns[txn.TransactionHash] = true
+		}
+	}
+
+	return v
+}
+
+// newTipValidator: creates a validator for blocks extending blocks, which must be our chain with the chain
+// index at its tip. The state is copied from the index, so nothing is replayed. Must be called with the mutex held.
+func newTipValidator(blocks []*Block, index *ChainIndex) *chainValidator {
+	v := new(chainValidator)
+	v.genesis = blocks[0]
+	v.chain = append([]*Block{}, blocks...)
+	v.state = index.State()
+	v.genesisSupply = GenesisSupply(blocks[0])
+	v.seenTxns = map[string]bool{}
+	v.index = index
+
+	return v
+}
+
+// connectChain: validates the blocks of chain in order with connect
+// Returns a *ValidationError describing the first invalid block
+func (v *chainValidator) connectChain(chain []*Block) error {
+	for _, block := range chain {
+		err := v.connect(block)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// included: reports whether a transaction with the given hash is part of the chain seen so far.
+// The index may have moved on since the validator was created, so a transaction found there only
+// counts if its block is part of our chain.
+func (v *chainValidator) included(txnHash string) bool {
+	if v.seenTxns[txnHash] {
+		return true
+	}
+	if v.index == nil {
+		return false
+	}
+
+	entry, ok := v.index.Transaction(txnHash)
+	return ok && entry.BlockNumber < uint64(len(v.chain)) && v.chain[entry.BlockNumber].Hash() == entry.BlockHash
+}
+
+// connect: validates a block on top of the chain seen so far and appends it
+// Returns a *ValidationError if the block is invalid
+func (v *chainValidator) connect(block *Block) error {
+	if block.BlockNumber != uint64(len(v.chain)) {
+		return newValidationError(block, "block number does not follow block %d", len(v.chain)-1)
+	}
+
+	if block.BlockNumber == 0 {
+		if block.Hash() != v.genesis.Hash() {
+			return newValidationError(block, "genesis block does not match ours")
+		}
+		v.state.ApplyBlock(block)
+		v.chain = append(v.chain, block)
+		return nil
+	}
+
+	err := validateHeader(v.chain, block)
+	if err != nil {
+		return err
+	}
+
+	err = v.validateTransactions(block)
+	if err != nil {
+		return err
+	}
+
+	v.chain = append(v.chain, block)
+
+	return nil
+}
+
+// validateHeader: checks that a block belongs to our chain ID and coinbase maturity, links to its parent, has a valid timestamp
+// and meets the difficulty dictated by NextDifficulty for the chain preceding it
+func validateHeader(prevChain []*Block, b *Block) error {
+	if b.ChainID != constants.CHAIN_ID {
+		return newValidationError(b, "chain id %q does not match %q", b.ChainID, constants.CHAIN_ID)
+	}
+
+	if b.CoinbaseMaturity != constants.COINBASE_MATURITY {
+		return newValidationError(b, "coinbase maturity %d does not match %d", b.CoinbaseMaturity, constants.COINBASE_MATURITY)
+	}
+
+	if prevChain[len(prevChain)-1].Hash() != b.PrevHash {
+		return newValidationError(b, "previous hash %s does not match parent", b.PrevHash)
+	}
+
+	err := validateTimestamp(prevChain, b)
+	if err != nil {
+		return err
+	}
+
+	expectedDifficulty := NextDifficulty(prevChain)
+	if b.Difficulty != expectedDifficulty {
+		return newValidationError(b, "difficulty %d does not match expected %d", b.Difficulty, expectedDifficulty)
+	}
+
+	if !meetsDifficulty(b.Hash(), b.Difficulty) {
+		return newValidationError(b, "hash does not meet difficulty %d", b.Difficulty)
+	}
+
+	return nil
+}
+
+// validateTransactions: replays the transactions of a block on top of the validator's state.
+// The state and the set of seen transaction hashes are updated as transactions are applied,
+// so blocks must be validated in order. The mining reward must equal the BlockReward for the
+// block's height plus the fees of the block's successful transactions, and it is held as
+// immature until COINBASE_MATURITY blocks later.
+func (v *chainValidator) validateTransactions(b *Block) error {
+	state := v.state
+	// Duplicating the last transaction of a block leaves its Merkle root unchanged, so blocks with
+	// duplicate transactions are rejected first
+	blockTxns := map[string]bool{}
+	for _, txn := range b.Transactions {
+		if blockTxns[txn.TransactionHash] {
+			return newValidationError(b, "duplicate transaction %s", txn.TransactionHash)
+		}
+		blockTxns[txn.TransactionHash] = true
+	}
+
+	if b.MerkleRoot != b.CalculateMerkleRoot() {
+		return newValidationError(b, "merkle root %s does not match transactions", b.MerkleRoot)
+	}
+
+	// Only rewards that have reached COINBASE_MATURITY can be spent by this block
+	state.MatureRewards(b.BlockNumber)
+
+	rewardCount := 0
+	var rewardTxn *Transaction
+	var fees uint64 = 0
+	blockSize := 0
+	for _, txn := range b.Transactions {
+		blockSize += txn.Size()
+
+		if v.included(txn.TransactionHash) {
+			return newValidationError(b, "duplicate transaction %s", txn.TransactionHash)
+		}
+		v.seenTxns[txn.TransactionHash] = true
+
+		if txn.From == constants.BLOCKCHAIN_ADDRESS {
+			rewardCount++
+			if txn.TransactionHash != txn.Hash() {
+				return newValidationError(b, "transaction hash %s does not match contents", txn.TransactionHash)
+			}
+			if txn.Status != constants.SUCCESS {
+				return newValidationError(b, "invalid status %q for mining reward %s", txn.Status, txn.TransactionHash)
+			}
+			if txn.ChainID != constants.CHAIN_ID {
+				return newValidationError(b, "mining reward %s has chain id %q", txn.TransactionHash, txn.ChainID)
+			}
+			// The reward is applied once the fees of the whole block are known
+			rewardTxn = txn
+			continue
+		}
+
+		// Only successful transactions are mined, a failed one could carry the hash of a pending
+		// transaction without its signature and keep it out of the chain
+		if txn.Status != constants.SUCCESS {
+			return newValidationError(b, "invalid status %q for transaction %s", txn.Status, txn.TransactionHash)
+		}
+
+		if !txn.VerifyTransaction() {
+			return newValidationError(b, "invalid hash or signature for transaction %s", txn.TransactionHash)
+		}
+
+		if txn.Nonce != state.NextNonce(txn.From) {
+			return newValidationError(b, "transaction %s has nonce %d, expected %d", txn.TransactionHash, txn.Nonce, state.NextNonce(txn.From))
+		}
+
+		if state.Balance(txn.From) < txn.Cost() {
+			return newValidationError(b, "transaction %s overspends balance of %s", txn.TransactionHash, txn.From)
+		}
+
+		if fees > math.MaxUint64-txn.Fee {
+			return newValidationError(b, "transaction fees overflow at transaction %s", txn.TransactionHash)
+		}
+		fees += txn.Fee
+		state.applyTransaction(txn)
+	}
+
+	if blockSize > constants.MAX_BLOCK_SIZE {
+		return newValidationError(b, "block size %d exceeds limit %d", blockSize, constants.MAX_BLOCK_SIZE)
+	}
+
+	if rewardCount != 1 {
+		return newValidationError(b, "expected exactly one mining reward, found %d", rewardCount)
+	}
+
+	blockReward := BlockReward(b.BlockNumber, v.genesisSupply)
+	if fees > math.MaxUint64-blockReward {
+		return newValidationError(b, "mining reward %d plus fees %d overflows", blockReward, fees)
+	}
+	expectedReward := blockReward + fees
+	if rewardTxn.Value != expectedReward {
+		return newValidationError(b, "invalid mining reward %d in transaction %s, expected %d", rewardTxn.Value, rewardTxn.TransactionHash, expectedReward)
+	}
+	state.addReward(rewardTxn, b.BlockNumber)
+
+	return nil
+}
+
+// recordRejection: logs a chain that failed validation and keeps it in the list of recent
+// rejections, dropping the oldest entries beyond MAX_BLOCK_REJECTIONS. The peer is penalized, see errorPenalty.
+func (bc *BlockchainCore) recordRejection(peer string, err error) {
+	log.Println("Rejected chain from peer:", peer, "Error:", err.Error())
+	bc.penalizeError(peer, err)
+
+	rejection := BlockRejection{
+		Peer:      peer,
+		Reason:    err.Error(),
+		Timestamp: time.Now().Unix(),
+	}
+	if validationErr, ok := err.(*ValidationError); ok {
+		rejection.BlockNumber = validationErr.BlockNumber
+		rejection.BlockHash = validationErr.BlockHash
+		rejection.Reason = validationErr.Reason
+	}
+
+	bc.mutex.Lock()
+	defer bc.mutex.Unlock()
+
+	bc.blockRejections = append(bc.blockRejections, rejection)
+	if len(bc.blockRejections) > constants.MAX_BLOCK_REJECTIONS {
+		bc.blockRejections = bc.blockRejections[len(bc.blockRejections)-constants.MAX_BLOCK_REJECTIONS:]
+	}
+}
+
+// GetBlockRejections: returns a copy of the most recent chain rejections, oldest first
+func (bc *BlockchainCore) GetBlockRejections() []BlockRejection {
+	bc.mutex.Lock()
+	defer bc.mutex.Unlock()
+
+	rejections := make([]BlockRejection, len(bc.blockRejections))
+	copy(rejections, bc.blockRejections)
+
+	return rejections
+}
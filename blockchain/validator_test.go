@@ -0,0 +1,162 @@
+package blockchain
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/SunTzu71/suntzu_blockchain/constants"
+)
+
+// testKey is a key pair signing transactions in tests
+type testKey struct {
+	privateKey *ecdsa.PrivateKey
+	publicKey  string
+	address    string
+}
+
+// newTestKey generates a key pair and derives its address
+func newTestKey(t *testing.T) *testKey {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publicKey := fmt.Sprintf("0x%064x%064x", privateKey.PublicKey.X, privateKey.PublicKey.Y)
+
+	return &testKey{privateKey: privateKey, publicKey: publicKey, address: GetAddressFromPublicKeyHex(publicKey)}
+}
+
+// transfer returns a transaction sending value to an address, signed by the key
+func (k *testKey) transfer(t *testing.T, to string, value uint64, fee uint64, nonce uint64) *Transaction {
+	return k.sign(t, NewTransaction(k.address, to, value, fee, nonce, []byte{}))
+}
+
+// sign signs a transaction with the key, updating its hash
+func (k *testKey) sign(t *testing.T, txn *Transaction) *Transaction {
+	txn.TransactionHash = txn.Hash()
+	hash := txn.SigningHash()
+
+	signature, err := ecdsa.SignASN1(rand.Reader, k.privateKey, hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	txn.Signature = signature
+	txn.PublicKey = k.publicKey
+
+	return txn
+}
+
+// testFundedBlockchain returns a blockchain kept in memory whose genesis block has difficulty 1
+// and allocates value to address
+func testFundedBlockchain(address string, value uint64) *BlockchainCore {
+	genesis := DefaultGenesis()
+	genesis.Difficulty = constants.MIN_MINING_DIFFICULTY
+	genesis.Alloc = map[string]uint64{address: value}
+
+	return NewBlockchain(*genesis.Block(), "", NewMemoryStore())
+}
+
+// testRemine recalculates the Merkle root of a block that was changed after mining and mines it again
+func testRemine(b *Block) {
+	b.MerkleRoot = b.CalculateMerkleRoot()
+	for b.Nonce = 0; !meetsDifficulty(b.Hash(), b.Difficulty); b.Nonce++ {
+	}
+}
+
+func TestValidateChain(t *testing.T) {
+	sender := newTestKey(t)
+	const receiver = "receiver"
+
+	tests := []struct {
+		name       string
+		block      func(chain []*Block) *Block
+		wantReject bool
+	}{
+		{"transfer within balance", func(chain []*Block) *Block {
+			return testMineBlock(chain, []*Transaction{sender.transfer(t, receiver, 600, 10, 0)}, "miner")
+		}, false},
+		{"overspend", func(chain []*Block) *Block {
+			return testMineBlock(chain, []*Transaction{sender.transfer(t, receiver, 1000, 10, 0)}, "miner")
+		}, true},
+		{"balance spent twice in one block", func(chain []*Block) *Block {
+			txns := []*Transaction{sender.transfer(t, receiver, 600, 0, 0), sender.transfer(t, receiver, 600, 0, 1)}
+			return testMineBlock(chain, txns, "miner")
+		}, true},
+		{"wrong nonce", func(chain []*Block) *Block {
+			return testMineBlock(chain, []*Transaction{sender.transfer(t, receiver, 600, 10, 1)}, "miner")
+		}, true},
+		{"forged signature", func(chain []*Block) *Block {
+			txn := sender.transfer(t, receiver, 600, 10, 0)
+			txn.To = "thief"
+			txn.TransactionHash = txn.Hash()
+			return testMineBlock(chain, []*Transaction{txn}, "miner")
+		}, true},
+		{"failed transaction", func(chain []*Block) *Block {
+			block := testMineBlock(chain, []*Transaction{sender.transfer(t, receiver, 600, 10, 0)}, "miner")
+			block.Transactions[0].Status = constants.FAILED
+			testRemine(block)
+			return block
+		}, true},
+		{"duplicate transaction", func(chain []*Block) *Block {
+			txn := sender.transfer(t, receiver, 100, 0, 0)
+			return testMineBlock(chain, []*Transaction{txn, txn}, "miner")
+		}, true},
+		{"inflated reward", func(chain []*Block) *Block {
+			block := testMineBlock(chain, nil, "miner")
+			reward := block.Transactions[0]
+			reward.Value++
+			reward.TransactionHash = reward.Hash()
+			testRemine(block)
+			return block
+		}, true},
+		{"missing reward", func(chain []*Block) *Block {
+			block := testMineBlock(chain, nil, "miner")
+			block.Transactions = []*Transaction{}
+			testRemine(block)
+			return block
+		}, true},
+		{"block from another chain", func(chain []*Block) *Block {
+			block := testMineBlock(chain, nil, "miner")
+			block.ChainID = "suntzuchain-testnet"
+			testRemine(block)
+			return block
+		}, true},
+		{"wrong difficulty", func(chain []*Block) *Block {
+			block := testMineBlock(chain, nil, "miner")
+			block.Difficulty++
+			testRemine(block)
+			return block
+		}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bc := testFundedBlockchain(sender.address, 1000)
+
+			err := bc.ValidateChain([]*Block{tt.block(bc.Blocks)})
+			if !tt.wantReject {
+				if err != nil {
+					t.Fatalf("ValidateChain() = %v, want nil", err)
+				}
+				return
+			}
+
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("ValidateChain() = %v, want a *ValidationError", err)
+			}
+		})
+	}
+}
+
+func TestValidateChainRejectsEmptyChain(t *testing.T) {
+	bc := testBlockchain(0, "miner")
+
+	if err := bc.ValidateChain([]*Block{}); err == nil {
+		t.Fatal("ValidateChain() = nil, want an error")
+	}
+}
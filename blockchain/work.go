@@ -0,0 +1,50 @@
+package blockchain
+
+import (
+	"math/big"
+)
+
+// BlockWork: returns the amount of proof-of-work represented by a block.
+// Each required leading hex zero multiplies the expected number of hashes by 16,
+// so the work of a block is 2^(4*difficulty).
+func BlockWork(b *Block) *big.Int {
+	return new(big.Int).Lsh(big.NewInt(1), uint(4*b.Difficulty))
+}
+
+// ChainWork: returns the accumulated proof-of-work of all blocks in the given chain
+func ChainWork(chain []*Block) *big.Int {
+	total := big.NewInt(0)
+	for _, block := range chain {
+		total.Add(total, BlockWork(block))
+	}
+
+	return total
+}
+
+// TotalWork: returns the accumulated proof-of-work of our chain from genesis to the tip
+func (bc *BlockchainCore) TotalWork() *big.Int {
+	return ChainWork(bc.GetBlocks())
+}
+
+// candidateWork: returns the total work of the chain formed by our blocks preceding the
+// fetched chain followed by the fetched chain itself. The fetched chain must start at or
+// before our height and link to our blocks, see extendsOurChain. Must be called with the mutex held.
+func (bc *BlockchainCore) candidateWork(chain []*Block) *big.Int {
+	initIndex := chain[0].BlockNumber
+	total := ChainWork(bc.Blocks[:initIndex])
+	total.Add(total, ChainWork(chain))
+
+	return total
+}
+
+// extendsOurChain: reports whether a fetched chain links to our blocks preceding it, which may no longer
+// be the case if a reorganization replaced them after the chain was validated.
+// Must be called with the mutex held.
+func (bc *BlockchainCore) extendsOurChain(chain []*Block) bool {
+	initIndex := chain[0].BlockNumber
+	if initIndex == 0 {
+		return chain[0].Hash() == bc.Blocks[0].Hash()
+	}
+
+	return initIndex <= uint64(len(bc.Blocks)) && bc.Blocks[initIndex-1].Hash() == chain[0].PrevHash
+}
@@ -0,0 +1,128 @@
+package blockchain
+
+import (
+	"math/big"
+	"strconv"
+	"testing"
+
+	"github.com/SunTzu71/suntzu_blockchain/constants"
+)
+
+// testMineBlock mines a block on top of chain holding copies of txns, which are marked successful,
+// followed by a reward to miner for the block reward plus the fees
+func testMineBlock(chain []*Block, txns []*Transaction, miner string) *Block {
+	parent := chain[len(chain)-1]
+	block := NewBlock(parent.Hash(), 0, parent.BlockNumber+1, NextDifficulty(chain))
+	block.Timestamp = max(block.Timestamp, MedianTimePast(chain)+1)
+
+	var fees uint64 = 0
+	for _, txn := range txns {
+		copied := *txn
+		copied.Status = constants.SUCCESS
+		block.Transactions = append(block.Transactions, &copied)
+		fees += txn.Fee
+	}
+
+	reward := NewTransaction(constants.BLOCKCHAIN_ADDRESS, miner, BlockReward(block.BlockNumber, GenesisSupply(chain[0]))+fees, 0, 0, []byte(strconv.FormatUint(block.BlockNumber, 10)))
+	reward.Status = constants.SUCCESS
+	block.Transactions = append(block.Transactions, reward)
+	block.MerkleRoot = block.CalculateMerkleRoot()
+
+	for !meetsDifficulty(block.Hash(), block.Difficulty) {
+		block.Nonce++
+	}
+
+	return block
+}
+
+// testExtendChain returns chain followed by count blocks mined to miner
+func testExtendChain(chain []*Block, count int, miner string) []*Block {
+	extended := append([]*Block{}, chain...)
+	for i := 0; i < count; i++ {
+		extended = append(extended, testMineBlock(extended, nil, miner))
+	}
+
+	return extended
+}
+
+// testBlockchain returns a blockchain kept in memory whose genesis block has difficulty 1,
+// extended by count blocks mined to miner
+func testBlockchain(count int, miner string) *BlockchainCore {
+	bc := NewBlockchain(*NewBlock("0x0", 0, 0, constants.MIN_MINING_DIFFICULTY), "", NewMemoryStore())
+	for _, block := range testExtendChain(bc.Blocks, count, miner)[1:] {
+		bc.AddBlock(block)
+	}
+
+	return bc
+}
+
+func TestChainWork(t *testing.T) {
+	tests := []struct {
+		name         string
+		difficulties []int
+		want         int64
+	}{
+		{"empty chain", []int{}, 0},
+		{"one block", []int{1}, 16},
+		{"work grows sixteen fold per difficulty", []int{2}, 256},
+		{"blocks add up", []int{1, 2, 3}, 16 + 256 + 4096},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chain := []*Block{}
+			for i, difficulty := range tt.difficulties {
+				chain = append(chain, NewBlock("0x0", 0, uint64(i), difficulty))
+			}
+
+			if got := ChainWork(chain); got.Cmp(big.NewInt(tt.want)) != 0 {
+				t.Errorf("ChainWork() = %s, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateBlockchainChoosesMostWork(t *testing.T) {
+	tests := []struct {
+		name         string
+		forkBlocks   int
+		otherGenesis bool
+		wantReplaced bool
+	}{
+		{"fork with more work", 3, false, true},
+		{"fork with equal work", 2, false, false},
+		{"fork with less work", 1, false, false},
+		{"chain from another genesis", 5, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bc := testBlockchain(3, "ours")
+			oldTip := bc.Blocks[3].Hash()
+
+			base := bc.Blocks[:2]
+			if tt.otherGenesis {
+				genesis := NewBlock("0x0", 0, 0, constants.MIN_MINING_DIFFICULTY)
+				genesis.Timestamp--
+				base = testExtendChain([]*Block{genesis}, 1, "theirs")
+			}
+			fork := testExtendChain(base, tt.forkBlocks, "theirs")[2:]
+
+			replaced, err := bc.UpdateBlockchain(fork)
+			if err != nil {
+				t.Fatalf("UpdateBlockchain() error = %v", err)
+			}
+			if replaced != tt.wantReplaced {
+				t.Fatalf("UpdateBlockchain() = %v, want %v", replaced, tt.wantReplaced)
+			}
+
+			wantTip := oldTip
+			if tt.wantReplaced {
+				wantTip = fork[len(fork)-1].Hash()
+			}
+			if tip := bc.Blocks[len(bc.Blocks)-1].Hash(); tip != wantTip {
+				t.Errorf("tip = %s, want %s", tip, wantTip)
+			}
+		})
+	}
+}
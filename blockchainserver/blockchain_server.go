@@ -1,10 +1,15 @@
 package blockchainserver
 
 import (
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"io"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
+	"slices"
 	"strconv"
 
 	"github.com/SunTzu71/suntzu_blockchain/blockchain"
@@ -17,10 +22,15 @@ type BlockchainServer struct {
 }
 
 // GetBlockchain: handles HTTP requests to retrieve the blockchain data
-// Returns the blockchain as JSON for GET requests and an error for other methods
+// Returns the blockchain as JSON for GET requests, gone if the node started from a snapshot
+// and does not store every block, and an error for other methods
 func (bcs *BlockchainServer) GetBlockchain(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	if r.Method == http.MethodGet {
+		if !bcs.BlockchainPtr.HasBlockBodies(0) {
+			http.Error(w, "Blocks up to the snapshot height are not stored", http.StatusGone)
+			return
+		}
 		io.WriteString(w, bcs.BlockchainPtr.ToJson())
 	} else {
 		http.Error(w, "Invalid method", http.StatusBadRequest)
@@ -29,15 +39,18 @@ func (bcs *BlockchainServer) GetBlockchain(w http.ResponseWriter, r *http.Reques
 }
 
 // GetBalance: handles HTTP requests to retrieve the balance for a given address
-// Returns the balance as JSON for GET requests and an error for other methods
+// Returns the spendable balance and the immature mining rewards as JSON for GET requests
+// and an error for other methods
 func (bcs *BlockchainServer) GetBalance(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	if r.Method == http.MethodGet {
 		address := r.URL.Query().Get("address")
 		x := struct {
-			Balance uint64 `json:"balance"`
+			Balance         uint64 `json:"balance"`
+			ImmatureBalance uint64 `json:"immature_balance"`
 		}{
 			bcs.BlockchainPtr.CalculateTotalCrypto(address),
+			bcs.BlockchainPtr.CalculateImmatureCrypto(address),
 		}
 		mBalance, err := json.Marshal(x)
 		if err != nil {
@@ -50,6 +63,30 @@ func (bcs *BlockchainServer) GetBalance(w http.ResponseWriter, r *http.Request)
 	}
 }
 
+// GetNextNonce: handles HTTP requests to retrieve the next expected nonce for a given address
+// Returns the nonce, including transactions waiting in the pool, as JSON for GET requests and an error for other methods
+func (bcs *BlockchainServer) GetNextNonce(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodGet {
+		address := r.URL.Query().Get("address")
+		x := struct {
+			Address   string `json:"address"`
+			NextNonce uint64 `json:"next_nonce"`
+		}{
+			address,
+			bcs.BlockchainPtr.GetNextNonce(address),
+		}
+		mNonce, err := json.Marshal(x)
+		if err != nil {
+			log.Fatal(err)
+		}
+		io.WriteString(w, string(mNonce))
+	} else {
+		http.Error(w, "Invalid method", http.StatusBadRequest)
+		return
+	}
+}
+
 // GetNonRewardedTransactions: handles HTTP requests to retrieve all non-rewarded transactions
 // Returns the list of non-rewarded transactions as JSON for GET requests and an error for other methods
 func (bcs *BlockchainServer) GetNonRewardedTransactions(w http.ResponseWriter, r *http.Request) {
@@ -68,32 +105,404 @@ func (bcs *BlockchainServer) GetNonRewardedTransactions(w http.ResponseWriter, r
 }
 
 // SendTranactionBlockchain: handles HTTP requests to add a new transaction to the blockchain
-// Accepts a transaction as JSON in POST requests and returns the added transaction
-// Returns an error for other methods
+// Accepts a transaction as JSON of at most MAX_TRANSACTION_REQUEST_SIZE bytes in POST requests and returns
+// the added transaction. The client is penalized by IP address for malformed JSON and for a transaction with
+// an invalid signature, see PenalizeClient.
+// Returns an error for other methods, banned clients, invalid or oversized data or requests from another chain
 func (bcs *BlockchainServer) SendTranactionBlockchain(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
+	if !checkChainID(w, r) {
+		return
+	}
+	if r.Method == http.MethodPost {
+		defer r.Body.Close()
+
+		host := remoteHost(r)
+		if bcs.BlockchainPtr.IsClientBanned(host) {
+			http.Error(w, "Client is banned", http.StatusForbidden)
+			return
+		}
+
+		request, err := io.ReadAll(http.MaxBytesReader(w, r.Body, constants.MAX_TRANSACTION_REQUEST_SIZE))
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, "Request too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		var newTransaction blockchain.Transaction
+		err = json.Unmarshal(request, &newTransaction)
+		if err != nil {
+			bcs.BlockchainPtr.PenalizeClient(host, constants.MALFORMED_DATA_PENALTY, err.Error())
+			http.Error(w, "Invalid transaction", http.StatusBadRequest)
+			return
+		}
+
+		// The transaction is written before it is added, since adding it updates its status
+		response := newTransaction.ToJson()
+		go func() {
+			if !bcs.BlockchainPtr.AddTransactionToTransactionPool(&newTransaction) {
+				bcs.BlockchainPtr.PenalizeClient(host, constants.INVALID_DATA_PENALTY, "invalid signature in transaction "+newTransaction.TransactionHash)
+			}
+		}()
+		io.WriteString(w, response)
+	} else {
+		http.Error(w, "Invalid method", http.StatusBadRequest)
+		return
+	}
+}
+
+// ReceiveBlock: handles block announcements from peers
+// Accepts a block announcement as JSON in POST requests, processes it in the background and returns
+// a success message. Returns an error for other methods, invalid data, requests from another chain
+// or requests not sent from the host of the announcing peer
+func (bcs *BlockchainServer) ReceiveBlock(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !checkChainID(w, r) {
+		return
+	}
 	if r.Method == http.MethodPost {
 		defer r.Body.Close()
 
 		request, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		ann := new(blockchain.BlockAnnouncement)
+		err = json.Unmarshal(request, ann)
+		if err != nil || ann.BlockHash == "" || ann.Address == "" {
+			http.Error(w, "Invalid block announcement", http.StatusBadRequest)
+			return
+		}
+		if !checkPeerAddress(w, r, ann.Address) {
+			return
+		}
+		go bcs.BlockchainPtr.ReceiveBlockAnnouncement(ann)
+		io.WriteString(w, `{"success":"success"}`)
+	} else {
+		http.Error(w, "Invalid method", http.StatusBadRequest)
+		return
+	}
+}
+
+// ReceiveTransactionInventory: handles transaction inventories from peers
+// Accepts a transaction inventory as JSON in POST requests, processes it in the background and returns
+// a success message. Returns an error for other methods, invalid data, requests from another chain
+// or requests not sent from the host of the announcing peer
+func (bcs *BlockchainServer) ReceiveTransactionInventory(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !checkChainID(w, r) {
+		return
+	}
+	if r.Method == http.MethodPost {
+		defer r.Body.Close()
+
+		request, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		inv := new(blockchain.TransactionInventory)
+		err = json.Unmarshal(request, inv)
+		if err != nil || inv.Address == "" || len(inv.TransactionHashes) > constants.MAX_INVENTORY_HASHES {
+			http.Error(w, "Invalid transaction inventory", http.StatusBadRequest)
+			return
+		}
+		if !checkPeerAddress(w, r, inv.Address) {
+			return
+		}
+		go bcs.BlockchainPtr.ReceiveTransactionInventory(inv)
+		io.WriteString(w, `{"success":"success"}`)
+	} else {
+		http.Error(w, "Invalid method", http.StatusBadRequest)
+		return
+	}
+}
+
+// GetPoolTransactions: handles requests from peers for transactions of the transaction pool
+// Accepts up to MAX_INVENTORY_HASHES transaction hashes as JSON in POST requests and returns the pool transactions
+// with those hashes as a JSON array. Returns an error for other methods, invalid data or requests from another chain
+func (bcs *BlockchainServer) GetPoolTransactions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !checkChainID(w, r) {
+		return
+	}
+	if r.Method == http.MethodPost {
+		defer r.Body.Close()
+
+		request, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		var x struct {
+			TransactionHashes []string `json:"transaction_hashes"`
+		}
+		err = json.Unmarshal(request, &x)
+		if err != nil || len(x.TransactionHashes) > constants.MAX_INVENTORY_HASHES {
+			http.Error(w, "Invalid transaction hashes", http.StatusBadRequest)
+			return
+		}
+
+		bs, err := json.Marshal(bcs.BlockchainPtr.GetPoolTransactions(x.TransactionHashes))
 		if err != nil {
 			log.Fatal(err)
 		}
+		io.WriteString(w, string(bs))
+	} else {
+		http.Error(w, "Invalid method", http.StatusBadRequest)
+		return
+	}
+}
+
+// Handshake: handles handshakes from peers
+// Accepts a peer's handshake as JSON in POST requests and returns our handshake if the peer is compatible.
+// The chain ID is checked as part of the handshake, so the request does not need the CHAIN_ID_HEADER header.
+// Returns a forbidden error with the reason for incompatible or banned peers or handshakes not sent from the host of the
+// peer's address, and an error for other methods or invalid data
+func (bcs *BlockchainServer) Handshake(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodPost {
 		defer r.Body.Close()
 
-		var newTransaction blockchain.Transaction
-		err = json.Unmarshal(request, &newTransaction)
+		request, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		h := new(blockchain.Handshake)
+		err = json.Unmarshal(request, h)
+		if err != nil || h.Address == "" {
+			http.Error(w, "Invalid handshake", http.StatusBadRequest)
+			return
+		}
+		if !checkPeerAddress(w, r, h.Address) {
+			return
+		}
+
+		err = bcs.BlockchainPtr.AcceptHandshake(h)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+
+		bs, err := json.Marshal(bcs.BlockchainPtr.NewHandshake())
+		if err != nil {
+			log.Fatal(err)
+		}
+		io.WriteString(w, string(bs))
+	} else {
+		http.Error(w, "Invalid method", http.StatusBadRequest)
+		return
+	}
+}
+
+// GetPeerInfo: handles HTTP requests to retrieve the result of the last handshake with every peer
+// Returns the peers with their protocol version, software version, chain, best height and work as JSON
+// for GET requests and an error for other methods
+func (bcs *BlockchainServer) GetPeerInfo(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodGet {
+		bs, err := json.Marshal(bcs.BlockchainPtr.GetPeerInfo())
 		if err != nil {
 			log.Fatal(err)
 		}
-		go bcs.BlockchainPtr.AddTransactionToTransactionPool(&newTransaction)
-		io.WriteString(w, newTransaction.ToJson())
+		io.WriteString(w, string(bs))
+	} else {
+		http.Error(w, "Invalid method", http.StatusBadRequest)
+		return
+	}
+}
+
+// GetPeerScores: handles HTTP requests to retrieve the score of every peer that is banned or lost points
+// Returns the peer scores as JSON for GET requests and an error for other methods
+func (bcs *BlockchainServer) GetPeerScores(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodGet {
+		bs, err := json.Marshal(bcs.BlockchainPtr.GetPeerScores())
+		if err != nil {
+			log.Fatal(err)
+		}
+		io.WriteString(w, string(bs))
+	} else {
+		http.Error(w, "Invalid method", http.StatusBadRequest)
+		return
+	}
+}
+
+// GetBannedPeers: handles HTTP requests to retrieve the banned peers with the reason and end of their ban
+// Returns the bans as JSON for GET requests and an error for other methods
+func (bcs *BlockchainServer) GetBannedPeers(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodGet {
+		bs, err := json.Marshal(bcs.BlockchainPtr.GetBannedPeers())
+		if err != nil {
+			log.Fatal(err)
+		}
+		io.WriteString(w, string(bs))
+	} else {
+		http.Error(w, "Invalid method", http.StatusBadRequest)
+		return
+	}
+}
+
+// BanPeer: handles admin requests to ban a peer
+// Accepts the peer, the ban duration in seconds (PEER_BAN_DURATION if not given) and a reason as JSON
+// in POST requests and returns a success message. The peer is a node address.
+// Returns an error for other methods, invalid data or requests without the admin token
+func (bcs *BlockchainServer) BanPeer(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !checkAdminToken(w, r) {
+		return
+	}
+	if r.Method == http.MethodPost {
+		defer r.Body.Close()
+
+		request, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		var x struct {
+			Peer     string `json:"peer"`
+			Duration int64  `json:"duration"`
+			Reason   string `json:"reason"`
+		}
+		err = json.Unmarshal(request, &x)
+		if err != nil || x.Peer == "" || x.Duration < 0 {
+			http.Error(w, "Invalid ban", http.StatusBadRequest)
+			return
+		}
+		if x.Duration == 0 {
+			x.Duration = constants.PEER_BAN_DURATION
+		}
+		if x.Reason == "" {
+			x.Reason = "banned by admin"
+		}
+
+		err = bcs.BlockchainPtr.BanPeer(x.Peer, x.Duration, x.Reason)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		io.WriteString(w, `{"success":"success"}`)
 	} else {
 		http.Error(w, "Invalid method", http.StatusBadRequest)
 		return
 	}
 }
 
+// UnbanPeer: handles admin requests to lift the ban of a peer
+// Accepts the peer as JSON in POST requests and returns a success message
+// Returns a not found error if the peer is not banned and an error for other methods, invalid data
+// or requests without the admin token
+func (bcs *BlockchainServer) UnbanPeer(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !checkAdminToken(w, r) {
+		return
+	}
+	if r.Method == http.MethodPost {
+		defer r.Body.Close()
+
+		request, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		var x struct {
+			Peer string `json:"peer"`
+		}
+		err = json.Unmarshal(request, &x)
+		if err != nil || x.Peer == "" {
+			http.Error(w, "Invalid peer", http.StatusBadRequest)
+			return
+		}
+
+		unbanned, err := bcs.BlockchainPtr.UnbanPeer(x.Peer)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !unbanned {
+			http.Error(w, "Peer is not banned", http.StatusNotFound)
+			return
+		}
+		io.WriteString(w, `{"success":"success"}`)
+	} else {
+		http.Error(w, "Invalid method", http.StatusBadRequest)
+		return
+	}
+}
+
+// checkChainID: verifies that a peer request carries our chain ID in the CHAIN_ID_HEADER header
+// Writes a forbidden error and returns false if the chain ID is missing or different
+func checkChainID(w http.ResponseWriter, r *http.Request) bool {
+	chainID := r.Header.Get(constants.CHAIN_ID_HEADER)
+	if chainID != constants.CHAIN_ID {
+		log.Println("Rejecting request to", r.URL.Path, "from chain:", chainID)
+		http.Error(w, "Chain ID mismatch", http.StatusForbidden)
+		return false
+	}
+
+	return true
+}
+
+// remoteHost: returns the IP address a request came from
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// checkPeerAddress: verifies that a request claiming to come from the peer at address was sent from the host of
+// that address, so a sender cannot get another peer penalized or make us fetch from it
+// Writes a forbidden error and returns false if the address is invalid or its host does not match the connection
+func checkPeerAddress(w http.ResponseWriter, r *http.Request, address string) bool {
+	peerURL, err := url.Parse(address)
+	if err == nil && peerURL.Hostname() != "" {
+		hosts, err := net.LookupHost(peerURL.Hostname())
+		if err == nil && slices.Contains(hosts, remoteHost(r)) {
+			return true
+		}
+	}
+
+	log.Println("Rejecting request to", r.URL.Path, "from", r.RemoteAddr, "claiming to be peer:", address)
+	http.Error(w, "Peer address does not match the connection", http.StatusForbidden)
+	return false
+}
+
+// checkAdminToken: verifies that an admin request carries our admin token in the ADMIN_TOKEN_HEADER header
+// Writes a forbidden error and returns false if admin endpoints are disabled or the token is missing or different
+func checkAdminToken(w http.ResponseWriter, r *http.Request) bool {
+	if constants.ADMIN_TOKEN == "" {
+		http.Error(w, "Admin endpoints are disabled", http.StatusForbidden)
+		return false
+	}
+
+	token := r.Header.Get(constants.ADMIN_TOKEN_HEADER)
+	if subtle.ConstantTimeCompare([]byte(token), []byte(constants.ADMIN_TOKEN)) != 1 {
+		log.Println("Rejecting admin request to", r.URL.Path, "from:", r.RemoteAddr)
+		http.Error(w, "Invalid admin token", http.StatusForbidden)
+		return false
+	}
+
+	return true
+}
+
 // CreateBlockchainServer: creates a new blockchain server with the given port and blockchain reference
 func CreateBlockchainServer(port uint64, blockchainPtr *blockchain.BlockchainCore) *BlockchainServer {
 	bcs := new(BlockchainServer)
@@ -114,9 +523,12 @@ func CheckServerStatus(w http.ResponseWriter, r *http.Request) {
 
 // SendPeersList: handles HTTP requests to update the list of blockchain peers
 // Accepts a peer list as JSON in POST requests and returns a success message
-// Returns an error for other methods or invalid data
+// Returns an error for other methods, invalid data or requests from another chain
 func (bcs *BlockchainServer) SendPeersList(w http.ResponseWriter, r *http.Request) {
 	w.Header().Add("Content-Type", "application/json")
+	if !checkChainID(w, r) {
+		return
+	}
 	if r.Method == http.MethodPost {
 		peersMap, err := io.ReadAll(r.Body)
 		if err != nil {
@@ -151,17 +563,25 @@ func (bcs *BlockchainServer) SendPeersList(w http.ResponseWriter, r *http.Reques
 // FetchConsensusBlocks: handles HTTP requests to fetch recent blocks for consensus
 // Returns the most recent blocks (up to FETCH_BLOCK_NUMBER) as JSON for GET requests
 // If fewer blocks exist than FETCH_BLOCK_NUMBER, returns all blocks
-// Returns an error for non-GET methods
+// Returns gone if the blocks start at or below the snapshot height the node started from
+// Returns an error for non-GET methods or requests from another chain
 func (bcs *BlockchainServer) FetchConsensusBlocks(w http.ResponseWriter, r *http.Request) {
 	w.Header().Add("Content-Type", "application/json")
+	if !checkChainID(w, r) {
+		return
+	}
 	if r.Method == http.MethodGet {
-		blocks := bcs.BlockchainPtr.Blocks
+		blocks := bcs.BlockchainPtr.GetBlocks()
 		blockchain1 := new(blockchain.BlockchainCore)
 		if len(blocks) < constants.FETCH_BLOCK_NUMBER {
 			blockchain1.Blocks = blocks
 		} else {
 			blockchain1.Blocks = blocks[len(blocks)-constants.FETCH_BLOCK_NUMBER:]
 		}
+		if !bcs.BlockchainPtr.HasBlockBodies(blockchain1.Blocks[0].BlockNumber) {
+			http.Error(w, "Blocks up to the snapshot height are not stored", http.StatusGone)
+			return
+		}
 		io.WriteString(w, blockchain1.ToJson())
 	} else {
 		http.Error(w, "Invalid method", http.StatusBadRequest)
@@ -169,19 +589,401 @@ func (bcs *BlockchainServer) FetchConsensusBlocks(w http.ResponseWriter, r *http
 	}
 }
 
+// GetChainWork: handles HTTP requests to retrieve the accumulated proof-of-work of the node's chain
+// Returns the tip block number and total work as JSON for GET requests and an error for other methods
+func (bcs *BlockchainServer) GetChainWork(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodGet {
+		blocks := bcs.BlockchainPtr.GetBlocks()
+		x := struct {
+			BlockNumber uint64 `json:"block_number"`
+			TotalWork   string `json:"total_work"`
+		}{
+			blocks[len(blocks)-1].BlockNumber,
+			blockchain.ChainWork(blocks).String(),
+		}
+		mWork, err := json.Marshal(x)
+		if err != nil {
+			log.Fatal(err)
+		}
+		io.WriteString(w, string(mWork))
+	} else {
+		http.Error(w, "Invalid method", http.StatusBadRequest)
+		return
+	}
+}
+
+// GetSupply: handles HTTP requests to retrieve the monetary supply of the node's chain
+// Returns the circulating supply, maximum supply and next block reward as JSON for GET requests
+// and an error for other methods
+func (bcs *BlockchainServer) GetSupply(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodGet {
+		blocks := bcs.BlockchainPtr.GetBlocks()
+		tip := blocks[len(blocks)-1].BlockNumber
+		x := struct {
+			BlockNumber       uint64 `json:"block_number"`
+			CirculatingSupply uint64 `json:"circulating_supply"`
+			MaxSupply         uint64 `json:"max_supply"`
+			NextBlockReward   uint64 `json:"next_block_reward"`
+			Currency          string `json:"currency"`
+			Decimal           uint64 `json:"decimal"`
+		}{
+			tip,
+			bcs.BlockchainPtr.CirculatingSupply(),
+			constants.MAX_SUPPLY,
+			blockchain.BlockReward(tip+1, blockchain.GenesisSupply(blocks[0])),
+			constants.CURRENCY_NAME,
+			constants.DECIMAL,
+		}
+		mSupply, err := json.Marshal(x)
+		if err != nil {
+			log.Fatal(err)
+		}
+		io.WriteString(w, string(mSupply))
+	} else {
+		http.Error(w, "Invalid method", http.StatusBadRequest)
+		return
+	}
+}
+
+// GetBlockRejections: handles HTTP requests to retrieve chains recently rejected during consensus
+// Returns the peer, block and reason of each rejection as JSON for GET requests and an error for other methods
+func (bcs *BlockchainServer) GetBlockRejections(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodGet {
+		bs, err := json.Marshal(bcs.BlockchainPtr.GetBlockRejections())
+		if err != nil {
+			log.Fatal(err)
+		}
+		io.WriteString(w, string(bs))
+	} else {
+		http.Error(w, "Invalid method", http.StatusBadRequest)
+		return
+	}
+}
+
+// GetReorgEvents: handles HTTP requests to retrieve recent chain reorganizations
+// Returns the fork height, depth and old/new tips of each reorg as JSON for GET requests and an error for other methods
+func (bcs *BlockchainServer) GetReorgEvents(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodGet {
+		bs, err := json.Marshal(bcs.BlockchainPtr.GetReorgEvents())
+		if err != nil {
+			log.Fatal(err)
+		}
+		io.WriteString(w, string(bs))
+	} else {
+		http.Error(w, "Invalid method", http.StatusBadRequest)
+		return
+	}
+}
+
+// GetMerkleProof: handles HTTP requests to retrieve a Merkle inclusion proof for a transaction
+// Returns the proof for the transaction_hash query parameter as JSON for GET requests,
+// not found if the transaction is not in any block and an error for other methods
+func (bcs *BlockchainServer) GetMerkleProof(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodGet {
+		txnHash := r.URL.Query().Get("transaction_hash")
+		proof, err := bcs.BlockchainPtr.GetMerkleProof(txnHash)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		bs, err := json.Marshal(proof)
+		if err != nil {
+			log.Fatal(err)
+		}
+		io.WriteString(w, string(bs))
+	} else {
+		http.Error(w, "Invalid method", http.StatusBadRequest)
+		return
+	}
+}
+
+// GetTransaction: handles HTTP requests to look up a transaction included in the chain
+// Returns the transaction for the transaction_hash query parameter with its block number, block hash and
+// position as JSON for GET requests, not found if the transaction is not in any block and an error for other methods
+func (bcs *BlockchainServer) GetTransaction(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodGet {
+		txnHash := r.URL.Query().Get("transaction_hash")
+		entry, err := bcs.BlockchainPtr.GetTransaction(txnHash)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		bs, err := json.Marshal(entry)
+		if err != nil {
+			log.Fatal(err)
+		}
+		io.WriteString(w, string(bs))
+	} else {
+		http.Error(w, "Invalid method", http.StatusBadRequest)
+		return
+	}
+}
+
+// GetAddressHistory: handles HTTP requests to retrieve the transactions of an address, newest first
+// The address query parameter selects the address, offset skips the newest transactions and limit sets
+// the page size (DEFAULT_HISTORY_PAGE_SIZE by default, at most MAX_HISTORY_PAGE_SIZE).
+// Returns the page and the address's total number of transactions as JSON for GET requests and an error
+// for other methods or invalid paging parameters
+func (bcs *BlockchainServer) GetAddressHistory(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodGet {
+		address := r.URL.Query().Get("address")
+		offset, err := queryInt(r, "offset", 0)
+		if err != nil || offset < 0 {
+			http.Error(w, "Invalid offset", http.StatusBadRequest)
+			return
+		}
+		limit, err := queryInt(r, "limit", constants.DEFAULT_HISTORY_PAGE_SIZE)
+		if err != nil || limit <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(limit, constants.MAX_HISTORY_PAGE_SIZE)
+
+		transactions, total := bcs.BlockchainPtr.GetAddressHistory(address, offset, limit)
+		x := struct {
+			Address      string                           `json:"address"`
+			Total        int                              `json:"total"`
+			Offset       int                              `json:"offset"`
+			Limit        int                              `json:"limit"`
+			Transactions []*blockchain.IndexedTransaction `json:"transactions"`
+		}{
+			address,
+			total,
+			offset,
+			limit,
+			transactions,
+		}
+		bs, err := json.Marshal(x)
+		if err != nil {
+			log.Fatal(err)
+		}
+		io.WriteString(w, string(bs))
+	} else {
+		http.Error(w, "Invalid method", http.StatusBadRequest)
+		return
+	}
+}
+
+// GetSnapshot: handles HTTP requests to retrieve the latest state snapshot
+// Returns the snapshot with the headers of the blocks it covers as JSON for GET requests,
+// not found if no snapshot has been produced yet and an error for other methods or requests from another chain
+func (bcs *BlockchainServer) GetSnapshot(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !checkChainID(w, r) {
+		return
+	}
+	if r.Method == http.MethodGet {
+		snapshot, err := bcs.BlockchainPtr.GetSnapshot()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		bs, err := json.Marshal(snapshot)
+		if err != nil {
+			log.Fatal(err)
+		}
+		io.WriteString(w, string(bs))
+	} else {
+		http.Error(w, "Invalid method", http.StatusBadRequest)
+		return
+	}
+}
+
+// GetBlockRange: handles HTTP requests to retrieve consecutive blocks
+// Returns up to count blocks (at most FETCH_BLOCK_NUMBER) starting at block number from as a JSON array
+// for GET requests, an empty array if from is past our tip, gone if from is at or below the snapshot height
+// the node started from and an error for other methods, invalid parameters or requests from another chain
+func (bcs *BlockchainServer) GetBlockRange(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !checkChainID(w, r) {
+		return
+	}
+	if r.Method == http.MethodGet {
+		from, err := queryInt(r, "from", 0)
+		if err != nil || from < 0 {
+			http.Error(w, "Invalid from", http.StatusBadRequest)
+			return
+		}
+		count, err := queryInt(r, "count", constants.FETCH_BLOCK_NUMBER)
+		if err != nil || count <= 0 {
+			http.Error(w, "Invalid count", http.StatusBadRequest)
+			return
+		}
+		count = min(count, constants.FETCH_BLOCK_NUMBER)
+
+		if !bcs.BlockchainPtr.HasBlockBodies(uint64(from)) {
+			http.Error(w, "Blocks up to the snapshot height are not stored", http.StatusGone)
+			return
+		}
+
+		blocks := bcs.BlockchainPtr.GetBlocks()
+		blockRange := []*blockchain.Block{}
+		if from < len(blocks) {
+			blockRange = blocks[from:min(from+count, len(blocks))]
+		}
+		bs, err := json.Marshal(blockRange)
+		if err != nil {
+			log.Fatal(err)
+		}
+		io.WriteString(w, string(bs))
+	} else {
+		http.Error(w, "Invalid method", http.StatusBadRequest)
+		return
+	}
+}
+
+// GetHeaderRange: handles HTTP requests to retrieve consecutive block headers
+// Returns up to count headers (at most FETCH_HEADER_NUMBER) starting at block number from as a JSON array
+// for GET requests, an empty array if from is past our tip and an error for other methods,
+// invalid parameters or requests from another chain
+func (bcs *BlockchainServer) GetHeaderRange(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !checkChainID(w, r) {
+		return
+	}
+	if r.Method == http.MethodGet {
+		from, err := queryInt(r, "from", 0)
+		if err != nil || from < 0 {
+			http.Error(w, "Invalid from", http.StatusBadRequest)
+			return
+		}
+		count, err := queryInt(r, "count", constants.FETCH_HEADER_NUMBER)
+		if err != nil || count <= 0 {
+			http.Error(w, "Invalid count", http.StatusBadRequest)
+			return
+		}
+		count = min(count, constants.FETCH_HEADER_NUMBER)
+
+		blocks := bcs.BlockchainPtr.GetBlocks()
+		headers := []blockchain.BlockHeader{}
+		if from < len(blocks) {
+			for _, block := range blocks[from:min(from+count, len(blocks))] {
+				headers = append(headers, block.Header())
+			}
+		}
+		bs, err := json.Marshal(headers)
+		if err != nil {
+			log.Fatal(err)
+		}
+		io.WriteString(w, string(bs))
+	} else {
+		http.Error(w, "Invalid method", http.StatusBadRequest)
+		return
+	}
+}
+
+// LocateFork: handles block locator requests from peers
+// Accepts a locator as JSON in POST requests and returns the highest block of it that is part of our chain
+// with the hashes of up to FETCH_HEADER_NUMBER blocks after it, not found if the locator shares no block
+// with our chain and an error for other methods, invalid data or requests from another chain
+func (bcs *BlockchainServer) LocateFork(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !checkChainID(w, r) {
+		return
+	}
+	if r.Method == http.MethodPost {
+		defer r.Body.Close()
+
+		request, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		var x struct {
+			Locator []string `json:"locator"`
+		}
+		err = json.Unmarshal(request, &x)
+		if err != nil || len(x.Locator) == 0 || len(x.Locator) > constants.MAX_LOCATOR_HASHES {
+			http.Error(w, "Invalid locator", http.StatusBadRequest)
+			return
+		}
+
+		fork, err := bcs.BlockchainPtr.FindFork(x.Locator, constants.FETCH_HEADER_NUMBER)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		bs, err := json.Marshal(fork)
+		if err != nil {
+			log.Fatal(err)
+		}
+		io.WriteString(w, string(bs))
+	} else {
+		http.Error(w, "Invalid method", http.StatusBadRequest)
+		return
+	}
+}
+
+// GetPeers: handles HTTP requests to retrieve the node's peer list
+// Returns the peers map as JSON for GET requests and an error for other methods or requests from another chain
+func (bcs *BlockchainServer) GetPeers(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !checkChainID(w, r) {
+		return
+	}
+	if r.Method == http.MethodGet {
+		io.WriteString(w, string(bcs.BlockchainPtr.PeersToJson()))
+	} else {
+		http.Error(w, "Invalid method", http.StatusBadRequest)
+		return
+	}
+}
+
+// queryInt: parses the integer query parameter name, returning defaultValue if it is absent
+func queryInt(r *http.Request, name string, defaultValue int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	return strconv.Atoi(value)
+}
+
 // StartBlockchainServer: starts the server to handle blockchain requests
+// Every server registers its handlers on its own ServeMux, so several nodes can run in one process
 func (bcs *BlockchainServer) StartBlockchainServer() {
-	http.HandleFunc("/", bcs.GetBlockchain)
-	http.HandleFunc("/balance", bcs.GetBalance)
-	http.HandleFunc("/get-non-rewarded-transactions", bcs.GetNonRewardedTransactions)
-	http.HandleFunc("/send-transaction", bcs.SendTranactionBlockchain)
-	http.HandleFunc("/send-peers-list", bcs.SendPeersList)
-	http.HandleFunc("/check-server-status", CheckServerStatus)
-	http.HandleFunc("/fetch-consensus-blocks", bcs.FetchConsensusBlocks)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", bcs.GetBlockchain)
+	mux.HandleFunc("/balance", bcs.GetBalance)
+	mux.HandleFunc("/nonce", bcs.GetNextNonce)
+	mux.HandleFunc("/get-non-rewarded-transactions", bcs.GetNonRewardedTransactions)
+	mux.HandleFunc("/send-transaction", bcs.SendTranactionBlockchain)
+	mux.HandleFunc("/send-peers-list", bcs.SendPeersList)
+	mux.HandleFunc("/check-server-status", CheckServerStatus)
+	mux.HandleFunc("/fetch-consensus-blocks", bcs.FetchConsensusBlocks)
+	mux.HandleFunc("/chain-work", bcs.GetChainWork)
+	mux.HandleFunc("/supply", bcs.GetSupply)
+	mux.HandleFunc("/block-rejections", bcs.GetBlockRejections)
+	mux.HandleFunc("/reorg-events", bcs.GetReorgEvents)
+	mux.HandleFunc("/merkle-proof", bcs.GetMerkleProof)
+	mux.HandleFunc("/transaction", bcs.GetTransaction)
+	mux.HandleFunc("/address-history", bcs.GetAddressHistory)
+	mux.HandleFunc("/snapshot", bcs.GetSnapshot)
+	mux.HandleFunc("/blocks", bcs.GetBlockRange)
+	mux.HandleFunc("/headers", bcs.GetHeaderRange)
+	mux.HandleFunc("/peers", bcs.GetPeers)
+	mux.HandleFunc("/locate-fork", bcs.LocateFork)
+	mux.HandleFunc("/receive-block", bcs.ReceiveBlock)
+	mux.HandleFunc("/transaction-inventory", bcs.ReceiveTransactionInventory)
+	mux.HandleFunc("/get-transactions", bcs.GetPoolTransactions)
+	mux.HandleFunc("/handshake", bcs.Handshake)
+	mux.HandleFunc("/peer-info", bcs.GetPeerInfo)
+	mux.HandleFunc("/peer-scores", bcs.GetPeerScores)
+	mux.HandleFunc("/banned-peers", bcs.GetBannedPeers)
+	mux.HandleFunc("/ban-peer", bcs.BanPeer)
+	mux.HandleFunc("/unban-peer", bcs.UnbanPeer)
 
 	log.Println("Starting server on port " + strconv.Itoa(int(bcs.Port)))
 
-	err := http.ListenAndServe("127.0.0.1:"+strconv.Itoa(int(bcs.Port)), nil) // TODO: place address in config file
+	err := http.ListenAndServe("127.0.0.1:"+strconv.Itoa(int(bcs.Port)), mux) // TODO: place address in config file
 	if err != nil {
 		log.Fatal("ListenAndServe: ", err)
 	}
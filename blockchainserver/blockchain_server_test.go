@@ -0,0 +1,39 @@
+package blockchainserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/SunTzu71/suntzu_blockchain/constants"
+)
+
+func TestCheckChainID(t *testing.T) {
+	tests := []struct {
+		name       string
+		chainID    string
+		wantOK     bool
+		wantStatus int
+	}{
+		{"our chain", constants.CHAIN_ID, true, http.StatusOK},
+		{"other chain", "suntzuchain-testnet", false, http.StatusForbidden},
+		{"missing header", "", false, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/peers", nil)
+			if tt.chainID != "" {
+				r.Header.Set(constants.CHAIN_ID_HEADER, tt.chainID)
+			}
+			w := httptest.NewRecorder()
+
+			if ok := checkChainID(w, r); ok != tt.wantOK {
+				t.Errorf("checkChainID() = %v, want %v", ok, tt.wantOK)
+			}
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -3,6 +3,18 @@ package constants
 // Database path for the blockchain
 var BLOCKCHAIN_DB_PATH string
 
+// Size limit in bytes used when assembling blocks to mine, at most MAX_BLOCK_SIZE
+var BLOCK_SIZE_LIMIT = MAX_BLOCK_SIZE
+
+// Identifier of the network this node belongs to, included in signatures, blocks and peer requests
+var CHAIN_ID = DEFAULT_CHAIN_ID
+
+// Number of confirmations before a mining reward can be spent, set from the genesis configuration
+var COINBASE_MATURITY uint64 = DEFAULT_COINBASE_MATURITY
+
+// Token required in the ADMIN_TOKEN_HEADER header of admin requests, admin endpoints are disabled when empty
+var ADMIN_TOKEN string
+
 // Constants used throughout the blockchain
 const (
 	BLOCKCHAIN_NAME            = "SunTzuChain"
@@ -10,8 +22,8 @@ const (
 	SUCCESS                    = "success"
 	FAILED                     = "failed"
 	PENDING                    = "pending"
-	MINING_DIFFICULTY          = 5
-	MINING_REWARD              = 100 * DECIMAL
+	MINING_DIFFICULTY          = 5             // initial difficulty used by the genesis block
+	MINING_REWARD              = 100 * DECIMAL // initial block reward, halved every HALVING_INTERVAL blocks
 	CURRENCY_NAME              = "SZU"
 	DECIMAL                    = 100
 	BLOCKCHAIN_ADDRESS         = "SunTzu_Faucet"
@@ -24,4 +36,70 @@ const (
 	PEER_PING_INTERVAL         = 60 // in seconds
 	FETCH_BLOCK_NUMBER         = 50 // number of blocks to fetchfor consensus
 	CONSENSUS_PAUSE_INTERVAL   = 10 // in seconds
+
+	FETCH_HEADER_NUMBER   = 2000 // maximum number of headers per /headers request while syncing
+	SYNC_WORKERS          = 4    // number of block ranges downloaded in parallel while syncing
+	LOCATOR_DENSE_HASHES  = 10   // number of consecutive tip hashes in a block locator before the spacing doubles
+	MAX_LOCATOR_HASHES    = 64   // maximum number of hashes accepted in a block locator
+	SEEN_BLOCK_CACHE_SIZE = 1000 // number of recently announced block hashes remembered to ignore echoes
+	MAX_ORPHAN_BLOCKS     = 100  // maximum number of blocks held while their parent is fetched
+	ORPHAN_EXPIRY         = 600  // in seconds, how long an orphan block is held before it is dropped
+
+	GOSSIP_WORKERS              = 8     // number of workers sending transaction inventories to peers
+	GOSSIP_QUEUE_SIZE           = 1000  // maximum number of transaction hashes queued for one peer
+	MAX_INVENTORY_HASHES        = 500   // maximum number of transaction hashes in one inventory or request
+	SEEN_TRANSACTION_CACHE_SIZE = 10000 // number of recently seen transaction hashes remembered to ignore echoes
+
+	PROTOCOL_VERSION     = 1              // version of the peer protocol spoken by this node
+	MIN_PROTOCOL_VERSION = 1              // oldest peer protocol version accepted in a handshake
+	SOFTWARE_VERSION     = "suntzu/0.1.0" // node software version reported in handshakes
+
+	PEER_REQUEST_TIMEOUT   = 30    // in seconds, how long a request to a peer may take
+	PEER_INITIAL_SCORE     = 100   // score of a peer we have no complaints about
+	PEER_BAN_THRESHOLD     = 0     // peers whose score drops below this are banned
+	PEER_BAN_DURATION      = 86400 // in seconds, how long an automatic ban lasts
+	PEER_SCORE_RECOVERY    = 60    // in seconds, time for a peer to win back one point of score
+	INVALID_DATA_PENALTY   = 50    // score lost for serving invalid blocks, headers or transactions
+	MALFORMED_DATA_PENALTY = 20    // score lost for sending malformed JSON
+	TIMEOUT_PENALTY        = 10    // score lost for a request that timed out
+
+	MIN_MINING_DIFFICULTY           = 1
+	MAX_MINING_DIFFICULTY           = 64
+	DIFFICULTY_ADJUSTMENT_INTERVAL  = 10  // number of blocks between difficulty retargets
+	DIFFICULTY_ADJUSTMENT_THRESHOLD = 4   // ratio between actual and target time that triggers a retarget
+	TARGET_BLOCK_TIME               = 10  // in seconds
+	MEDIAN_TIME_BLOCKS              = 11  // number of previous blocks whose median timestamp a new block must exceed
+	MAX_FUTURE_BLOCK_TIME           = 120 // in seconds a block timestamp may be ahead of our clock
+
+	MAX_BLOCK_REJECTIONS = 100 // number of rejected peer chains kept for reporting
+	MAX_REORG_EVENTS     = 100 // number of chain reorganizations kept for reporting
+
+	DEFAULT_HISTORY_PAGE_SIZE = 20  // number of transactions returned by /address-history when no limit is given
+	MAX_HISTORY_PAGE_SIZE     = 100 // maximum number of transactions returned by one /address-history request
+
+	TRANSACTION_ENCODING_VERSION = 4 // version byte of the canonical transaction encoding
+	BLOCK_ENCODING_VERSION       = 3 // version byte of the canonical block header encoding
+
+	MAX_BLOCK_SIZE               = 1024 * 1024        // maximum size in bytes of the transactions in a block
+	MAX_TRANSACTION_REQUEST_SIZE = 2 * MAX_BLOCK_SIZE // maximum size in bytes of a transaction sent to /send-transaction
+
+	ARCHIVE_MAGIC           = "SUNTZUCHAIN"      // first bytes of a chain archive written by chain export
+	ARCHIVE_FORMAT_VERSION  = 1                  // version byte of the chain archive format
+	MAX_ARCHIVE_RECORD_SIZE = 4 * MAX_BLOCK_SIZE // maximum size in bytes of one block record in a chain archive
+
+	SNAPSHOT_INTERVAL         = 1000 // number of blocks between state snapshots
+	SNAPSHOT_CONFIRMATIONS    = 100  // number of blocks a snapshot height must be below the tip
+	SNAPSHOT_ENCODING_VERSION = 1    // version byte of the canonical state snapshot encoding
+
+	HALVING_INTERVAL = 100000             // number of blocks between block reward halvings
+	TAIL_EMISSION    = 0                  // minimum block reward once halvings bring it lower, 0 disables tail emission
+	MAX_SUPPLY       = 21000000 * DECIMAL // hard cap on the total supply including genesis allocations
+
+	DEFAULT_CHAIN_ID  = "suntzuchain-mainnet"
+	GENESIS_TIMESTAMP = 1735689600 // timestamp of the default genesis block, 2025-01-01 UTC
+
+	DEFAULT_COINBASE_MATURITY = 10           // number of confirmations before a mining reward can be spent
+	CHAIN_ID_HEADER           = "X-Chain-ID" // HTTP header carrying the chain ID on peer requests
+
+	ADMIN_TOKEN_HEADER = "X-Admin-Token" // HTTP header carrying the admin token on admin requests
 )
@@ -27,9 +27,16 @@ func main() {
 	chainMiner := chainCommandSet.String("miner", "", "miner address")
 	remoteNode := chainCommandSet.String("remote_node", "", "remote node address")
 	dbPath := chainCommandSet.String("db_path", "", "database path")
+	blockSize := chainCommandSet.Int("block_size", constants.MAX_BLOCK_SIZE, "size limit in bytes of mined blocks")
+	chainID := chainCommandSet.String("chain_id", constants.DEFAULT_CHAIN_ID, "network identifier")
+	genesisPath := chainCommandSet.String("genesis", "", "genesis configuration file (JSON)")
+	archivePath := chainCommandSet.String("file", "", "chain archive file for the export and import commands")
+	snapshotHash := chainCommandSet.String("snapshot_hash", "", "trusted state snapshot hash to bootstrap from remote_node")
+	adminToken := chainCommandSet.String("admin_token", "", "token required by the admin endpoints, disabled when empty")
 
 	walletPort := walletCommandSet.Uint("port", 8080, "port to run the wallet server")
 	blockchainNodeAddress := walletCommandSet.String("node", "http://127.0.0.1:8000", "blockchain node address")
+	walletChainID := walletCommandSet.String("chain_id", constants.DEFAULT_CHAIN_ID, "network identifier")
 
 	if len(os.Args) < 2 {
 		fmt.Println("Error: expected chain or wallet command")
@@ -37,7 +44,15 @@ func main() {
 
 	switch os.Args[1] {
 	case "chain":
-		chainCommandSet.Parse(os.Args[2:])
+		// chain export and chain import take the same flags as chain
+		chainArgs := os.Args[2:]
+		chainAction := ""
+		if len(chainArgs) > 0 && (chainArgs[0] == "export" || chainArgs[0] == "import") {
+			chainAction = chainArgs[0]
+			chainArgs = chainArgs[1:]
+		}
+
+		chainCommandSet.Parse(chainArgs)
 		if chainCommandSet.Parsed() {
 
 			constants.BLOCKCHAIN_DB_PATH = fmt.Sprintf("%d/suntzuchain.db", *chainPort)
@@ -45,16 +60,79 @@ func main() {
 				constants.BLOCKCHAIN_DB_PATH = *dbPath
 			}
 
+			if *blockSize <= 0 || *blockSize > constants.MAX_BLOCK_SIZE {
+				fmt.Println("Error: block_size must be between 1 and", constants.MAX_BLOCK_SIZE)
+				os.Exit(1)
+			}
+			constants.BLOCK_SIZE_LIMIT = *blockSize
+			constants.CHAIN_ID = *chainID
+			constants.ADMIN_TOKEN = *adminToken
+
+			genesis := blockchain.DefaultGenesis()
+			if *genesisPath != "" {
+				var err error
+				genesis, err = blockchain.LoadGenesis(*genesisPath)
+				if err != nil {
+					log.Fatal(err)
+				}
+
+				chainIDSet := false
+				chainCommandSet.Visit(func(f *flag.Flag) {
+					chainIDSet = chainIDSet || f.Name == "chain_id"
+				})
+				if chainIDSet && *chainID != genesis.ChainID {
+					fmt.Println("Error: chain_id", *chainID, "does not match genesis chain_id", genesis.ChainID)
+					os.Exit(1)
+				}
+				constants.CHAIN_ID = genesis.ChainID
+				constants.COINBASE_MATURITY = genesis.CoinbaseMaturity
+			}
+			genesisBlock := genesis.Block()
+			log.Println("Genesis block:", genesisBlock.Hash(), "chain id:", constants.CHAIN_ID)
+
+			if chainAction != "" {
+				if *archivePath == "" {
+					fmt.Println("Usage of chain " + chainAction + " subcommand: ")
+					chainCommandSet.PrintDefaults()
+					os.Exit(1)
+				}
+
+				store, err := blockchain.NewLevelDBStore(constants.BLOCKCHAIN_DB_PATH)
+				if err != nil {
+					log.Fatal(err)
+				}
+				defer store.Close()
+
+				address := "http://127.0.0.1:" + strconv.Itoa(int(*chainPort))
+				if chainAction == "export" {
+					err = exportChain(*archivePath, genesisBlock, address, store)
+				} else {
+					err = importChain(*archivePath, genesisBlock, address, store)
+				}
+				if err != nil {
+					log.Println(err)
+					store.Close()
+					os.Exit(1)
+				}
+				return
+			}
+
 			if *chainMiner == "" || chainCommandSet.NFlag() == 0 {
 				fmt.Println("Usage of chain subcommand: ")
 				chainCommandSet.PrintDefaults()
 				os.Exit(1)
 			}
 
+			store, err := blockchain.NewLevelDBStore(constants.BLOCKCHAIN_DB_PATH)
+			if err != nil {
+				log.Fatal(err)
+			}
+			// Close the database once the interrupt signal stops the node
+			defer store.Close()
+
 			// if remote node is empty launch new blockchain
 			if *remoteNode == "" {
-				genesisBlock := blockchain.NewBlock("0x0", 0, 0)
-				blockchain := blockchain.NewBlockchain(*genesisBlock, "http://127.0.0.1:"+strconv.Itoa(int(*chainPort)))
+				blockchain := blockchain.NewBlockchain(*genesisBlock, "http://127.0.0.1:"+strconv.Itoa(int(*chainPort)), store)
 				blockchain.Peers[blockchain.Address] = true
 				bcs := blockchainserver.CreateBlockchainServer(uint64(*chainPort), blockchain)
 				go bcs.StartBlockchainServer()
@@ -67,14 +145,41 @@ func main() {
 				signal.Notify(c, os.Interrupt)
 				<-c
 			} else {
-				blockchain1, err := blockchain.SyncBlockchain(*remoteNode)
+				address := "http://127.0.0.1:" + strconv.Itoa(int(*chainPort))
+				var blockchain2 *blockchain.BlockchainCore
+				if *snapshotHash != "" {
+					blockchain1, err := blockchain.SyncBlockchainFromSnapshot(*remoteNode, genesisBlock, *snapshotHash)
+					if err != nil {
+						log.Fatal(err)
+					}
+					blockchain2 = blockchain.NewBlockchainSync(blockchain1, address, store)
+				} else {
+					// Resume from our database if we have one, the sync below downloads the missing blocks
+					blockchain2 = blockchain.NewBlockchain(*genesisBlock, address, store)
+				}
+
+				// Join the network of the remote node once it accepts our handshake
+				err = blockchain2.HandshakePeer(*remoteNode)
+				if err != nil {
+					log.Fatal(err)
+				}
+				peers, err := blockchain.FetchPeers(*remoteNode)
+				if err != nil {
+					log.Fatal(err)
+				}
+				for peer, status := range blockchain2.GetPeers() {
+					peers[peer] = peers[peer] || status
+				}
+				peers[*remoteNode] = true
+				peers[blockchain2.Address] = true
+				blockchain2.UpdatePeers(peers)
+
+				// Catch up with the network before mining
+				err = blockchain2.Sync()
 				if err != nil {
 					log.Fatal(err)
-					os.Exit(1)
 				}
 
-				blockchain2 := blockchain.NewBlockchainSync(blockchain1, "http://127.0.0.1:"+strconv.Itoa(int(*chainPort)))
-				blockchain2.Peers[blockchain2.Address] = true
 				bcs := blockchainserver.CreateBlockchainServer(uint64(*chainPort), blockchain2)
 				go bcs.StartBlockchainServer()
 				go bcs.BlockchainPtr.ProofOfWorkMining(*chainMiner)
@@ -95,6 +200,7 @@ func main() {
 				walletCommandSet.PrintDefaults()
 				os.Exit(1)
 			}
+			constants.CHAIN_ID = *walletChainID
 			ws := walletserver.CreateWalletServer(uint16(*walletPort), *blockchainNodeAddress)
 			go ws.StartWalletServer()
 
@@ -108,3 +214,44 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// exportChain: writes the blockchain held in store to a chain archive at path
+func exportChain(path string, genesisBlock *blockchain.Block, address string, store blockchain.Store) error {
+	if !store.Exists() {
+		return fmt.Errorf("no blockchain found at %s", constants.BLOCKCHAIN_DB_PATH)
+	}
+	bc := blockchain.NewBlockchain(*genesisBlock, address, store)
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	err = bc.ExportChain(file)
+	if err != nil {
+		return err
+	}
+
+	log.Println("Exported", len(bc.Blocks), "blocks to", path)
+
+	return file.Close()
+}
+
+// importChain: validates the chain archive at path and stores it as a new blockchain
+func importChain(path string, genesisBlock *blockchain.Block, address string, store blockchain.Store) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	bc, err := blockchain.ImportChain(file, genesisBlock, address, store)
+	if err != nil {
+		return err
+	}
+
+	log.Println("Imported", len(bc.Blocks), "blocks from", path, "into", constants.BLOCKCHAIN_DB_PATH)
+
+	return nil
+}
@@ -4,13 +4,10 @@ import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
-	"crypto/sha256"
-	"encoding/json"
 	"fmt"
 	"math/big"
 
 	"github.com/SunTzu71/suntzu_blockchain/blockchain"
-	"github.com/SunTzu71/suntzu_blockchain/constants"
 )
 
 type Wallet struct {
@@ -58,35 +55,26 @@ func (w *Wallet) GetPrivateKeyHex() string {
 }
 
 // GetPublicKeyHex returns the public key as a hexadecimal string prefixed with "0x",
-// concatenating the X and Y coordinates of the public key point on the curve
+// concatenating the X and Y coordinates of the public key point on the curve,
+// each zero padded to 64 characters
 func (w *Wallet) GetPublicKeyHex() string {
-	return fmt.Sprintf("0x%x%x", w.PublicKey.X, w.PublicKey.Y)
+	return fmt.Sprintf("0x%064x%064x", w.PublicKey.X, w.PublicKey.Y)
 }
 
-// GetAddress generates a unique address for the wallet by:
-// 1. Taking the public key (without "0x" prefix)
-// 2. Computing its SHA256 hash
-// 3. Converting hash to hex string
-// 4. Taking last 40 chars and prepending ADDRESS_PREFIX
+// GetAddress generates a unique address for the wallet from its public key
+// using blockchain.GetAddressFromPublicKeyHex
 func (w *Wallet) GetAddress() string {
-	hash := sha256.Sum256([]byte(w.GetPublicKeyHex()[2:]))
-	hex := fmt.Sprintf("%x", hash[:])
-	address := constants.ADDRESS_PREFIX + hex[len(hex)-40:]
-	return address
+	return blockchain.GetAddressFromPublicKeyHex(w.GetPublicKeyHex())
 }
 
 // GetSignedTxn takes an unsigned transaction and returns a signed copy of it.
 // It does this by:
-// 1. Marshaling the transaction to JSON and computing its SHA256 hash
+// 1. Computing the SHA256 hash of the transaction's canonical signing payload
 // 2. Signing the hash with the wallet's private key using ECDSA
 // 3. Creating a new transaction with the same fields plus signature and public key
 // 4. Returns pointer to signed transaction and any error that occurred
 func (w *Wallet) GetSignedTransaction(unsignedTxn blockchain.Transaction) (*blockchain.Transaction, error) {
-	bs, err := json.Marshal(unsignedTxn)
-	if err != nil {
-		return nil, err
-	}
-	hash := sha256.Sum256(bs)
+	hash := unsignedTxn.SigningHash()
 
 	sig, err := ecdsa.SignASN1(rand.Reader, w.PrivateKey, hash[:])
 	if err != nil {
@@ -94,11 +82,14 @@ func (w *Wallet) GetSignedTransaction(unsignedTxn blockchain.Transaction) (*bloc
 	}
 
 	var signedTxn blockchain.Transaction
+	signedTxn.ChainID = unsignedTxn.ChainID
 	signedTxn.From = unsignedTxn.From
 	signedTxn.To = unsignedTxn.To
 	signedTxn.Data = unsignedTxn.Data
 	signedTxn.Status = unsignedTxn.Status
 	signedTxn.Value = unsignedTxn.Value
+	signedTxn.Fee = unsignedTxn.Fee
+	signedTxn.Nonce = unsignedTxn.Nonce
 	signedTxn.Timestamp = unsignedTxn.Timestamp
 	signedTxn.TransactionHash = unsignedTxn.TransactionHash
 
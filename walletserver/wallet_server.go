@@ -83,6 +83,33 @@ func (ws *WalletServer) GetTotalCryptoFromWallet(w http.ResponseWriter, r *http.
 	}
 }
 
+// getNextNonce: asks the blockchain node for the nonce the next transaction from an address must carry
+func (ws *WalletServer) getNextNonce(address string) (uint64, error) {
+	params := url.Values{}
+	params.Add("address", address)
+	ourUrl := fmt.Sprintf("%s?%s", ws.BlockchainNodeAddress+"/nonce", params.Encode())
+	response, err := http.Get(ourUrl)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return 0, err
+	}
+
+	var x struct {
+		NextNonce uint64 `json:"next_nonce"`
+	}
+	err = json.Unmarshal(data, &x)
+	if err != nil {
+		return 0, err
+	}
+
+	return x.NextNonce, nil
+}
+
 // SendTransaction: handles POST requests to create and send a new transaction using the provided private key
 // and transaction details, sending it to the blockchain node and returning the response
 // TODO: Find a better way to send transaction and not send private key
@@ -105,7 +132,13 @@ func (ws *WalletServer) SendTransaction(w http.ResponseWriter, r *http.Request)
 		}
 
 		wallet1 := wallet.NewWalletFromPrivateKeyHex(privateKey)
-		myTransaction := blockchain.NewTransaction(wallet1.GetAddress(), trans1.To, trans1.Value, []byte{})
+		nonce, err := ws.getNextNonce(wallet1.GetAddress())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		myTransaction := blockchain.NewTransaction(wallet1.GetAddress(), trans1.To, trans1.Value, trans1.Fee, nonce, []byte{})
 		myTransaction.Status = constants.PENDING
 		newTransaction, err := wallet1.GetSignedTransaction(*myTransaction)
 
@@ -116,7 +149,15 @@ func (ws *WalletServer) SendTransaction(w http.ResponseWriter, r *http.Request)
 		}
 
 		// Send transaction to blockchain
-		response, err := http.Post(ws.BlockchainNodeAddress+"/send-transaction", "application/json", bytes.NewBuffer(newTransactionBytes))
+		request, err := http.NewRequest(http.MethodPost, ws.BlockchainNodeAddress+"/send-transaction", bytes.NewBuffer(newTransactionBytes))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		request.Header.Set("Content-Type", "application/json")
+		request.Header.Set(constants.CHAIN_ID_HEADER, constants.CHAIN_ID)
+
+		response, err := http.DefaultClient.Do(request)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return